@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	m "github.com/tak1827/merk-go/merk"
+	"github.com/tak1827/merk-go/merk/proof"
+)
+
+type command struct {
+	minArgs, maxArgs int // maxArgs < 0 means unlimited
+	run              func(c *config, args []string) error
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"get":       &command{1, 1, get},
+		"put":       &command{2, 2, put},
+		"delete":    &command{1, 1, del},
+		"root":      &command{0, 0, root},
+		"versions":  &command{0, 0, versions},
+		"snapshots": &command{0, 0, snapshots},
+		"prove":     &command{1, -1, prove},
+		"verify":    &command{3, -1, verify},
+		"dump":      &command{0, 0, dump},
+		"import":    &command{1, 1, importDump},
+		"check":     &command{0, 0, check},
+	}
+}
+
+// open opens the database read only, unless writable which creates the directory if missing
+func open(c *config, writable bool) (*m.Merk, func(), error) {
+	// the versions out of the retention are deleted by the commit, so it's not defaulted
+	if writable && !c.keepSet {
+		return nil, nil, errors.New("-keep-recent is required to commit, set it as the application does")
+	}
+
+	if !writable {
+		if _, err := os.Stat(c.dir); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	opts := m.DefaultOptions()
+	opts.ReadOnly = !writable
+	opts.KeepRecent, opts.KeepEvery = c.keep[0], c.keep[1]
+
+	db, err := m.NewBadger(c.dir, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merk, err := m.New(db, opts)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	return merk, func() { db.Close() }, nil
+}
+
+// tree returns the tree at -version, or the latest one
+func tree(c *config, merk *m.Merk) (*m.Tree, error) {
+	if c.version == 0 {
+		return merk.Tree, nil
+	}
+
+	view, err := merk.AtVersion(c.version)
+	if err != nil {
+		return nil, err
+	}
+
+	return view.Tree, nil
+}
+
+func get(c *config, args []string) error {
+	key, err := decode(c.enc, args[0])
+	if err != nil {
+		return err
+	}
+
+	merk, closeDB, err := open(c, false)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	t, err := tree(c, merk)
+	if err != nil {
+		return err
+	}
+
+	value, found, err := (&m.View{Tree: t}).GetWithFound(key)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("%w: %v", m.ErrNotFound, args[0])
+	}
+
+	fmt.Fprintln(c.stdout, encode(c.enc, value))
+
+	return nil
+}
+
+func put(c *config, args []string) error {
+	key, err := decode(c.enc, args[0])
+	if err != nil {
+		return err
+	}
+
+	value, err := decode(c.enc, args[1])
+	if err != nil {
+		return err
+	}
+
+	return apply(c, m.Batch{&m.OP{O: m.Put, K: key, V: value}})
+}
+
+func del(c *config, args []string) error {
+	key, err := decode(c.enc, args[0])
+	if err != nil {
+		return err
+	}
+
+	return apply(c, m.Batch{&m.OP{O: m.Del, K: key}})
+}
+
+// apply applies the batch and commits, prints the new root hash
+func apply(c *config, batch m.Batch) error {
+	merk, closeDB, err := open(c, true)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	if _, err := merk.Apply(batch, true); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "%x\n", merk.RootHash())
+
+	return nil
+}
+
+func root(c *config, args []string) error {
+	merk, closeDB, err := open(c, false)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	fmt.Fprintf(c.stdout, "%x\n", merk.RootHash())
+
+	return nil
+}
+
+func versions(c *config, args []string) error {
+	merk, closeDB, err := open(c, false)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	for _, v := range merk.Versions() {
+		view, err := merk.AtVersion(v)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.stdout, "%v\t%x\n", v, view.RootHash())
+	}
+
+	return nil
+}
+
+func snapshots(c *config, args []string) error {
+	merk, closeDB, err := open(c, false)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	snapshots, err := merk.Snapshots()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range snapshots {
+		fmt.Fprintf(c.stdout, "%x\t%v\n", s.Root, s.Refs)
+	}
+
+	return nil
+}
+
+// decodeKeys returns the sorted unique keys, as proofs are created for them
+func decodeKeys(enc string, args []string) ([][]byte, error) {
+	keys := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		key, err := decode(enc, arg)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	batch := make(m.Batch, len(keys))
+	for i, key := range keys {
+		batch[i] = &m.OP{K: key}
+	}
+	batch = m.SortBatch(batch)
+
+	keys = keys[:0]
+	for _, op := range batch {
+		if len(keys) == 0 || !bytes.Equal(keys[len(keys)-1], op.K) {
+			keys = append(keys, op.K)
+		}
+	}
+
+	return keys, nil
+}
+
+func prove(c *config, args []string) error {
+	keys, err := decodeKeys(c.enc, args)
+	if err != nil {
+		return err
+	}
+
+	merk, closeDB, err := open(c, false)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	t, err := tree(c, merk)
+	if err != nil {
+		return err
+	}
+
+	buf, err := proof.Prove(t, keys)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.stdout, encode(c.proofEnc, buf))
+
+	return nil
+}
+
+// verify doesn't open the database, the proof is verified by the root hash alone
+func verify(c *config, args []string) error {
+	h, err := hex.DecodeString(args[0])
+	if err != nil || len(h) != m.HashSize {
+		return fmt.Errorf("root must be a hex encoded hash, %v", args[0])
+	}
+
+	var expected m.Hash
+	copy(expected[:], h)
+
+	buf, err := decode(c.proofEnc, args[1])
+	if err != nil {
+		return err
+	}
+
+	keys, err := decodeKeys(c.enc, args[2:])
+	if err != nil {
+		return err
+	}
+
+	results, err := proof.Verify(buf, keys, expected)
+	if err != nil {
+		return err
+	}
+
+	for i, r := range results {
+		if r.Found {
+			fmt.Fprintf(c.stdout, "%v\t%v\n", encode(c.enc, keys[i]), encode(c.enc, r.Value))
+		} else {
+			fmt.Fprintf(c.stdout, "%v\tabsent\n", encode(c.enc, keys[i]))
+		}
+	}
+
+	return nil
+}
+
+var dumpFormats = map[string]m.DumpFormat{
+	"json":   m.DumpJSON,
+	"binary": m.DumpBinary,
+}
+
+func dump(c *config, args []string) error {
+	merk, closeDB, err := open(c, false)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	t, err := tree(c, merk)
+	if err != nil {
+		return err
+	}
+
+	return (&m.View{Tree: t}).Export(c.stdout, dumpFormats[c.dumpFmt])
+}
+
+func importDump(c *config, args []string) error {
+	var r io.Reader = c.stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	merk, closeDB, err := open(c, true)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	if err := merk.Import(r); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "%x\n", merk.RootHash())
+
+	return nil
+}
+
+func check(c *config, args []string) error {
+	merk, closeDB, err := open(c, false)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	report, err := merk.Check()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(c.stdout, report)
+
+	if !report.OK() {
+		return errIssues
+	}
+
+	return nil
+}
+
+func decode(enc, s string) ([]byte, error) {
+	switch enc {
+	case "text":
+		return []byte(s), nil
+	case "hex":
+		return hex.DecodeString(s)
+	case "base64":
+		return base64.StdEncoding.DecodeString(s)
+	default:
+		return nil, fmt.Errorf("unknown encoding, %v", enc)
+	}
+}
+
+func encode(enc string, b []byte) string {
+	switch enc {
+	case "hex":
+		return hex.EncodeToString(b)
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b)
+	default:
+		return string(b)
+	}
+}
@@ -0,0 +1,125 @@
+// Command merk inspects and edits a Merk stored in a badger directory.
+//
+//	merk -dir ./storage/example root
+//	merk -dir ./storage/example -keep-recent 1 put key0 value0
+//	merk -dir ./storage/example -enc hex get 6b657930
+//
+// Run merk -h for the commands.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `Usage: merk -dir <dir> [flags] <command> [args]
+
+Commands:
+  get <key>                       print the value of the key
+  put <key> <value>               put the value and commit
+  delete <key>                    delete the key and commit
+  root                            print the root hash
+  versions                        list the retained versions with the root hashes
+  snapshots                       list the snapshots with the reference counts
+  prove <key>...                  print the proof of the keys
+  verify <root> <proof> <key>...  verify the proof against the root hash, print the values
+  dump                            print the dump of the tree in -dump-format
+  import <file>                   load the dump of either format into an empty database, - reads stdin
+  check                           check the integrity of the stored tree
+
+Keys and values are encoded by -enc, proofs by -proof-enc, and hashes in hex.
+put, delete and import require -keep-recent, as the retention is not stored in the database.
+
+Flags:
+`
+
+// errIssues makes the exit status 1 when the check found issues
+var errIssues = errors.New("integrity check failed")
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if err != flag.ErrHelp && err != errIssues {
+			fmt.Fprintf(os.Stderr, "merk: %v\n", err)
+		}
+		if err == flag.ErrHelp {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+type config struct {
+	dir      string
+	version  uint64
+	keep     [2]uint64
+	keepSet  bool // -keep-recent is given, which the commands committing require
+	enc      string
+	proofEnc string
+	dumpFmt  string
+
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	c := &config{stdin: stdin, stdout: stdout}
+
+	fs := flag.NewFlagSet("merk", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&c.dir, "dir", "", "database directory (required)")
+	fs.Uint64Var(&c.version, "version", 0, "read the tree at the version instead of the latest (get, prove, dump)")
+	fs.Uint64Var(&c.keep[0], "keep-recent", 0, "KeepRecent of the commits by put, delete and import (required by them), set it as the application does, 0 keeps all versions")
+	fs.Uint64Var(&c.keep[1], "keep-every", 0, "KeepEvery of the commits by put, delete and import, set it as the application does")
+	fs.StringVar(&c.enc, "enc", "text", "encoding of keys and values: text, hex or base64")
+	fs.StringVar(&c.proofEnc, "proof-enc", "hex", "encoding of proofs: hex or base64")
+	fs.StringVar(&c.dumpFmt, "dump-format", "json", "format of dump: json or binary")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if c.dir == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "keep-recent" {
+			c.keepSet = true
+		}
+	})
+
+	if _, err := decode(c.enc, ""); err != nil {
+		return err
+	}
+	if c.proofEnc == "text" {
+		return fmt.Errorf("unsupported proof encoding, %v", c.proofEnc)
+	}
+	if _, err := decode(c.proofEnc, ""); err != nil {
+		return err
+	}
+	if _, ok := dumpFormats[c.dumpFmt]; !ok {
+		return fmt.Errorf("unknown dump format, %v", c.dumpFmt)
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown command, %v", fs.Arg(0))
+	}
+
+	cmdArgs := fs.Args()[1:]
+	if len(cmdArgs) < cmd.minArgs || (cmd.maxArgs >= 0 && len(cmdArgs) > cmd.maxArgs) {
+		return fmt.Errorf("wrong number of arguments for %v, see merk -h", fs.Arg(0))
+	}
+
+	return cmd.run(c, cmdArgs)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	m "github.com/tak1827/merk-go/merk"
+)
+
+func runCmd(t *testing.T, stdin string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	err := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func mustRun(t *testing.T, stdin string, args ...string) string {
+	out, err := runCmd(t, stdin, args...)
+	require.NoError(t, err)
+	return out
+}
+
+func TestCommands(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "merk-cmd")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	dir := filepath.Join(tmp, "db")
+
+	_, err = runCmd(t, "", "-dir", dir, "root")
+	require.Error(t, err)
+
+	// the retention is required to commit
+	_, err = runCmd(t, "", "-dir", dir, "put", "key0", "value0")
+	require.Error(t, err)
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+
+	mustRun(t, "", "-dir", dir, "-keep-recent", "0", "put", "key0", "value0")
+	mustRun(t, "", "-dir", dir, "-keep-recent", "0", "put", "key1", "value1")
+	root := mustRun(t, "", "-dir", dir, "-keep-recent", "0", "put", "key2", "value2")
+	mustRun(t, "", "-dir", dir, "-keep-recent", "0", "delete", "key2")
+
+	require.EqualValues(t, "value0\n", mustRun(t, "", "-dir", dir, "get", "key0"))
+	require.EqualValues(t, "76616c756531\n", mustRun(t, "", "-dir", dir, "-enc", "hex", "get", "6b657931"))
+	require.EqualValues(t, "value2\n", mustRun(t, "", "-dir", dir, "-version", "3", "get", "key2"))
+
+	_, err = runCmd(t, "", "-dir", dir, "get", "key2")
+	require.True(t, errors.Is(err, m.ErrNotFound))
+
+	// the dump of either format is imported into another database
+	latest := mustRun(t, "", "-dir", dir, "root")
+	dump := mustRun(t, "", "-dir", dir, "dump")
+	require.Contains(t, dump, `"root":"`+strings.TrimSpace(latest)+`"`)
+	require.Contains(t, dump, `{"key":"a2V5MA==","value":"dmFsdWUw","depth":1}`)
+
+	for _, format := range []string{"json", "binary"} {
+		file := filepath.Join(tmp, "dump."+format)
+		require.NoError(t, ioutil.WriteFile(file, []byte(mustRun(t, "", "-dir", dir, "-dump-format", format, "dump")), 0644))
+
+		imported := filepath.Join(tmp, format)
+		require.EqualValues(t, latest, mustRun(t, "", "-dir", imported, "-keep-recent", "1", "import", file))
+		require.EqualValues(t, dump, mustRun(t, "", "-dir", imported, "dump"))
+
+		_, err = runCmd(t, "", "-dir", imported, "-keep-recent", "1", "import", file)
+		require.Error(t, err)
+	}
+
+	// all versions are kept by -keep-recent 0
+	versions := mustRun(t, "", "-dir", dir, "versions")
+	require.Contains(t, versions, "3\t"+root)
+	require.EqualValues(t, 4, strings.Count(versions, "\n"))
+
+	check := mustRun(t, "", "-dir", dir, "check")
+	require.Contains(t, check, "issues: 0")
+
+	// the proof of the old version verifies against its root hash
+	p := strings.TrimSpace(mustRun(t, "", "-dir", dir, "-version", "3", "-proof-enc", "base64", "prove", "key2", "key3"))
+	out := mustRun(t, "", "-dir", dir, "-proof-enc", "base64", "verify", strings.TrimSpace(root), p, "key3", "key2")
+	require.EqualValues(t, "key2\tvalue2\nkey3\tabsent\n", out)
+
+	_, err = runCmd(t, "", "-dir", dir, "-proof-enc", "base64", "verify", strings.TrimSpace(latest), p, "key2")
+	require.Error(t, err)
+
+	_, err = runCmd(t, "", "-dir", dir, "get")
+	require.Error(t, err)
+	_, err = runCmd(t, "", "-dir", dir, "unknown")
+	require.Error(t, err)
+	_, err = runCmd(t, "", "-dir", dir, "-enc", "rot13", "root")
+	require.Error(t, err)
+	_, err = runCmd(t, "", "-dir", dir, "-dump-format", "xml", "dump")
+	require.Error(t, err)
+}
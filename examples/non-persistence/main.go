@@ -21,7 +21,11 @@ func main() {
 	if _, err := m.Apply(insertBatch, true); err != nil {
 		log.Panic(err)
 	}
-	fmt.Printf("inserted value of key0: %v\n", string(m.Get([]byte("key0"))))
+	value, err := m.Get([]byte("key0"))
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("inserted value of key0: %v\n", string(value))
 
 	var updateBatch merk.Batch = []*merk.OP{
 		&merk.OP{O: merk.Put, K: []byte("key0"), V: []byte("value10")},
@@ -31,7 +35,11 @@ func main() {
 	if _, err := m.Apply(updateBatch, true); err != nil {
 		log.Panic(err)
 	}
-	fmt.Printf("updated value of key0: %v\n", string(m.Get([]byte("key0"))))
+	value, err = m.Get([]byte("key0"))
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("updated value of key0: %v\n", string(value))
 
 	var deleteBatch merk.Batch = []*merk.OP{
 		&merk.OP{O: merk.Del, K: []byte("key0")},
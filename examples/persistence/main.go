@@ -9,17 +9,19 @@ import (
 const storageDir string = "../storage/example"
 
 func main() {
-	m, db, err := merk.New(storageDir)
+	db, err := merk.NewBadger(storageDir, merk.DefaultOptions())
 	if err != nil {
-		if db != nil {
-			db.Close()
-		}
 		log.Panic(err)
 	}
 
 	defer db.Close()   // close bager
 	defer db.Destroy() // clear all data
 
+	m, err := merk.New(db, merk.DefaultOptions())
+	if err != nil {
+		log.Panic(err)
+	}
+
 	var insertBatch merk.Batch = []*merk.OP{
 		&merk.OP{O: merk.Put, K: []byte("key0"), V: []byte("value0")},
 		&merk.OP{O: merk.Put, K: []byte("key1"), V: []byte("value1")},
@@ -30,7 +32,11 @@ func main() {
 	if _, err := m.Apply(insertBatch, true); err != nil {
 		log.Panic(err)
 	}
-	fmt.Printf("inserted value of key0: %v\n", string(m.Get([]byte("key0"))))
+	value, err := m.Get([]byte("key0"))
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("inserted value of key0: %v\n", string(value))
 
 	var updateBatch merk.Batch = []*merk.OP{
 		&merk.OP{O: merk.Put, K: []byte("key0"), V: []byte("value10")},
@@ -40,7 +46,11 @@ func main() {
 	if _, err := m.Apply(updateBatch, true); err != nil {
 		log.Panic(err)
 	}
-	fmt.Printf("updated value of key0: %v\n", string(m.Get([]byte("key0"))))
+	value, err = m.Get([]byte("key0"))
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("updated value of key0: %v\n", string(value))
 
 	var deleteBatch merk.Batch = []*merk.OP{
 		&merk.OP{O: merk.Del, K: []byte("key0")},
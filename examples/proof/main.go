@@ -10,17 +10,19 @@ import (
 const storageDir string = "../storage/example"
 
 func main() {
-	m, db, err := m.New(storageDir)
+	db, err := m.NewBadger(storageDir, m.DefaultOptions())
 	if err != nil {
-		if db != nil {
-			db.Close()
-		}
 		log.Panic(err)
 	}
 
 	defer db.Close()   // close bager
 	defer db.Destroy() // clear all data
 
+	m, err := m.New(db, m.DefaultOptions())
+	if err != nil {
+		log.Panic(err)
+	}
+
 	buildTree(m)
 
 	// Create proof
@@ -36,7 +38,7 @@ func main() {
 		log.Panic(err)
 	}
 
-	fmt.Printf("the values of keys, %v, %v\n", string(output[0]), string(output[1]))
+	fmt.Printf("the values of keys, %v, %v\n", string(output[0].Value), string(output[1].Value))
 }
 
 func buildTree(merk *m.Merk) {
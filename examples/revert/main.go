@@ -10,21 +10,23 @@ import (
 const storageDir string = "../storage/example"
 
 func main() {
-	merk, db, err := m.New(storageDir)
+	db, err := m.NewBadger(storageDir, m.DefaultOptions())
 	if err != nil {
-		if db != nil {
-			db.Close()
-		}
 		log.Panic(err)
 	}
 
 	defer db.Close()   // close bager
 	defer db.Destroy() // clear all data
 
+	merk, err := m.New(db, m.DefaultOptions())
+	if err != nil {
+		log.Panic(err)
+	}
+
 	buildTree(merk)
 
 	// take snapshot
-	snapshotKey, err := m.TakeDBSnapshot()
+	snapshotKey, err := merk.TakeDBSnapshot()
 	if err != nil {
 		log.Panic(err)
 	}
@@ -42,6 +44,14 @@ func main() {
 	if err = merk.Revert(snapshotKey); err != nil {
 		log.Panic(err)
 	}
+	if err = merk.Commit(); err != nil {
+		log.Panic(err)
+	}
+
+	// release snapshot, the nodes only pinned by it are deleted
+	if err = merk.ReleaseSnapshot(snapshotKey); err != nil {
+		log.Panic(err)
+	}
 }
 
 func buildTree(merk *m.Merk) {
@@ -0,0 +1,305 @@
+package merk
+
+import (
+	"fmt"
+	"github.com/lithdew/bytesutil"
+	"io"
+)
+
+// A chunk is the top of a subtree, which contains the nodes in breadth-first order as long as
+// the encoded size is within the chunk size. The subtrees below are boundaries, whose hash and
+// child heights are in the chunk, and become the roots of the following chunks in key order.
+// So each chunk is verified by the hash expected from the former chunks, like a proof.
+//
+// A chunk is encoded as proof ops in key order:
+// Push KV: 0x03 | key length(4) | key | value length(4) | value
+// Push Boundary: 0x01 | hash(32) | child heights(2)
+// Parent: 0x10, Child: 0x11
+
+const (
+	chunkBoundary byte = 0x01
+	chunkKV       byte = 0x03
+	chunkParent   byte = 0x10
+	chunkChild    byte = 0x11
+
+	boundaryOPSize = 1 + HashSize + 2
+)
+
+type ChunkProducer struct {
+	db        DB
+	chunkSize int
+	stack     []Hash // roots of the remaining chunks, the next one on the top
+}
+
+// ChunkProducer returns the producer of the chunks of the tree at the root, which must be retained
+// while producing. Each chunk is at most chunkSize bytes, unless a single node exceeds it.
+func (m *Merk) ChunkProducer(root Hash, chunkSize int) (*ChunkProducer, error) {
+	if m.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	if root == NullHash {
+		return nil, fmt.Errorf("%w: cannot create chunks", ErrEmptyTree)
+	}
+
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive, %v", chunkSize)
+	}
+
+	return &ChunkProducer{db: m.db, chunkSize: chunkSize, stack: []Hash{root}}, nil
+}
+
+// Next returns the next chunk, io.EOF if all chunks are produced
+func (p *ChunkProducer) Next() ([]byte, error) {
+	if len(p.stack) == 0 {
+		return nil, io.EOF
+	}
+
+	root := p.stack[len(p.stack)-1]
+
+	buf, boundaries, err := createChunk(p.db, root, p.chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	p.stack = p.stack[:len(p.stack)-1]
+	for i := len(boundaries) - 1; i >= 0; i-- {
+		p.stack = append(p.stack, boundaries[i].h)
+	}
+
+	return buf, nil
+}
+
+// Chunk returns the chunk at the root of a subtree, e.g. the one Restorer.Next expects
+// when resuming the restoration
+func (m *Merk) Chunk(root Hash, chunkSize int) ([]byte, error) {
+	if m.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive, %v", chunkSize)
+	}
+
+	buf, _, err := createChunk(m.db, root, chunkSize)
+	return buf, err
+}
+
+// createChunk returns the chunk at the root, and the boundaries in key order
+func createChunk(db DB, root Hash, chunkSize int) ([]byte, []*Pruned, error) {
+	tree, err := fetchTree(db, root[:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch node %v: %w", root, err)
+	}
+
+	// the size when the node is included instead of its boundary
+	nodeSize := func(t *Tree) int {
+		size := 1 + 4 + len(t.Key()) + 4 + len(t.Value())
+		for _, l := range []Link{t.Link(true), t.Link(false)} {
+			if l != nil {
+				size += boundaryOPSize + 1 // boundary and Parent or Child
+			}
+		}
+		return size
+	}
+
+	var (
+		included = map[Hash]*Tree{root: tree}
+		queue    = []*Tree{tree}
+		size     = nodeSize(tree)
+	)
+
+	// include nodes in breadth-first order
+bfs:
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+
+		for _, l := range []Link{t.Link(true), t.Link(false)} {
+			if l == nil {
+				continue
+			}
+
+			h := l.Hash()
+			child, err := fetchTree(db, h[:])
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to fetch node %v: %w", h, err)
+			}
+
+			grown := size - boundaryOPSize + nodeSize(child)
+			if grown > chunkSize {
+				break bfs
+			}
+
+			size = grown
+			included[h] = child
+			queue = append(queue, child)
+		}
+	}
+
+	var (
+		buf        []byte = make([]byte, 0, size)
+		boundaries []*Pruned
+	)
+
+	var encode func(t *Tree)
+	encodeChild := func(l Link) {
+		if child, ok := included[l.Hash()]; ok {
+			encode(child)
+			return
+		}
+
+		b := &Pruned{ch: l.ChildHeights(), h: l.Hash()}
+		boundaries = append(boundaries, b)
+		buf = appendBoundaryOP(buf, b)
+	}
+
+	encode = func(t *Tree) {
+		left, right := t.Link(true), t.Link(false)
+
+		if left != nil {
+			encodeChild(left)
+		}
+
+		buf = append(buf, chunkKV)
+		buf = bytesutil.AppendUint32BE(buf, uint32(len(t.Key())))
+		buf = append(buf, t.Key()...)
+		buf = bytesutil.AppendUint32BE(buf, uint32(len(t.Value())))
+		buf = append(buf, t.Value()...)
+
+		if left != nil {
+			buf = append(buf, chunkParent)
+		}
+
+		if right != nil {
+			encodeChild(right)
+			buf = append(buf, chunkChild)
+		}
+	}
+
+	encode(tree)
+
+	return buf, boundaries, nil
+}
+
+func appendBoundaryOP(dst []byte, b *Pruned) []byte {
+	dst = append(dst, chunkBoundary)
+	dst = append(dst, b.h[:]...)
+	return append(dst, b.ch[:]...)
+}
+
+// chunkItem is a node on the stack when executing a chunk, either a tree or a boundary
+type chunkItem struct {
+	tree     *Tree
+	boundary *Pruned
+}
+
+func (i *chunkItem) link() *Pruned {
+	if i.tree != nil {
+		return &Pruned{ch: i.tree.ChildHeights(), h: i.tree.Hash()}
+	}
+	return i.boundary
+}
+
+// executeChunk rebuilds the chunk, returns the root, the nodes and the boundaries in key order
+func executeChunk(buf []byte) (*Tree, []*Tree, []*Pruned, error) {
+	var (
+		stack      []*chunkItem
+		trees      []*Tree
+		boundaries []*Pruned
+	)
+
+	readBytes := func(n int) ([]byte, error) {
+		if len(buf) < n {
+			return nil, fmt.Errorf("%w: unexpected end", ErrMalformedChunk)
+		}
+		b := buf[:n]
+		buf = buf[n:]
+		return b, nil
+	}
+
+	readLenPrefixed := func() ([]byte, error) {
+		b, err := readBytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return readBytes(int(bytesutil.Uint32BE(b)))
+	}
+
+	attach := func(isLeft bool) error {
+		if len(stack) < 2 {
+			return fmt.Errorf("%w: stack underflow", ErrMalformedChunk)
+		}
+
+		var parent, child *chunkItem
+		if isLeft {
+			parent, child = stack[len(stack)-1], stack[len(stack)-2]
+		} else {
+			parent, child = stack[len(stack)-2], stack[len(stack)-1]
+		}
+		stack = stack[:len(stack)-2]
+
+		if parent.tree == nil {
+			return fmt.Errorf("%w: cannot attach to boundary", ErrMalformedChunk)
+		}
+
+		if parent.tree.Link(isLeft) != nil {
+			return fmt.Errorf("%w: %v child is already attached", ErrMalformedChunk, sideToStr(isLeft))
+		}
+
+		parent.tree.setLink(isLeft, child.link())
+		stack = append(stack, parent)
+
+		return nil
+	}
+
+	for len(buf) > 0 {
+		op, _ := readBytes(1)
+
+		switch op[0] {
+		case chunkKV:
+			key, err := readLenPrefixed()
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			value, err := readLenPrefixed()
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			t := newTree(copyBytes(key), copyBytes(value))
+			trees = append(trees, t)
+			stack = append(stack, &chunkItem{tree: t})
+
+		case chunkBoundary:
+			b, err := readBytes(HashSize + 2)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			p := &Pruned{ch: [2]uint8{b[HashSize], b[HashSize+1]}}
+			copy(p.h[:], b[:HashSize])
+			boundaries = append(boundaries, p)
+			stack = append(stack, &chunkItem{boundary: p})
+
+		case chunkParent:
+			if err := attach(true); err != nil {
+				return nil, nil, nil, err
+			}
+
+		case chunkChild:
+			if err := attach(false); err != nil {
+				return nil, nil, nil, err
+			}
+
+		default:
+			return nil, nil, nil, fmt.Errorf("%w: unknown op %v", ErrMalformedChunk, op[0])
+		}
+	}
+
+	if len(stack) != 1 || stack[0].tree == nil {
+		return nil, nil, nil, fmt.Errorf("%w: expected to result in exactly one tree", ErrMalformedChunk)
+	}
+
+	return stack[0].tree, trees, boundaries, nil
+}
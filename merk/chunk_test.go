@@ -0,0 +1,119 @@
+package merk
+
+import (
+	"github.com/stretchr/testify/require"
+	"io"
+	"strconv"
+	"testing"
+)
+
+func TestChunkRestore(t *testing.T) {
+	m, err := New(NewMemDB(), DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 1000, Put, "value"), true)
+	require.NoError(t, err)
+
+	root := m.RootHash()
+
+	p, err := m.ChunkProducer(root, 1024)
+	require.NoError(t, err)
+
+	db := NewMemDB()
+	r, err := NewRestorer(db, root)
+	require.NoError(t, err)
+
+	chunks := 0
+	for {
+		chunk, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.True(t, len(chunk) <= 1024)
+		require.False(t, r.Done())
+
+		require.NoError(t, r.Process(chunk))
+		chunks++
+	}
+	require.True(t, chunks > 1)
+	require.True(t, r.Done())
+	require.Error(t, r.Process([]byte{chunkKV}))
+
+	require.EqualValues(t, storedNodes(t, m.db), storedNodes(t, db))
+
+	restored, err := New(db, DefaultOptions())
+	require.NoError(t, err)
+	require.EqualValues(t, root, restored.RootHash())
+	require.NoError(t, restored.Tree.verify())
+
+	it := restored.Iterator(nil, nil)
+	defer it.Close()
+	for i := 0; i < 1000; i++ {
+		require.True(t, it.Next())
+		require.EqualValues(t, []byte("key"+strconv.Itoa(1000+i)), it.Key())
+	}
+	require.False(t, it.Next())
+
+	// the restored tree is writable
+	_, err = restored.Apply(buildSeqBatch(0, 10, Put, "value2"), true)
+	require.NoError(t, err)
+	_, err = m.Apply(buildSeqBatch(0, 10, Put, "value2"), true)
+	require.NoError(t, err)
+	require.EqualValues(t, m.RootHash(), restored.RootHash())
+}
+
+func TestChunkRestoreResume(t *testing.T) {
+	m, err := New(NewMemDB(), DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 300, Put, "value"), true)
+	require.NoError(t, err)
+
+	root := m.RootHash()
+
+	db := NewMemDB()
+	r, err := NewRestorer(db, root)
+	require.NoError(t, err)
+
+	next, ok := r.Next()
+	require.True(t, ok)
+	require.EqualValues(t, root, next)
+
+	for i := 0; i < 3; i++ {
+		next, _ := r.Next()
+		chunk, err := m.Chunk(next, 512)
+		require.NoError(t, err)
+
+		// tampered chunk is rejected without progress
+		tampered := append([]byte{}, chunk...)
+		tampered[len(tampered)-2] ^= 1
+		require.Error(t, r.Process(tampered))
+		require.Error(t, r.Process(chunk[:len(chunk)-1]))
+
+		require.NoError(t, r.Process(chunk))
+	}
+
+	_, err = NewRestorer(db, Hash{1})
+	require.Error(t, err)
+
+	// resume with another restorer
+	r, err = NewRestorer(db, root)
+	require.NoError(t, err)
+
+	for !r.Done() {
+		next, _ := r.Next()
+		chunk, err := m.Chunk(next, 512)
+		require.NoError(t, err)
+		require.NoError(t, r.Process(chunk))
+	}
+
+	restored, err := New(db, DefaultOptions())
+	require.NoError(t, err)
+	require.EqualValues(t, root, restored.RootHash())
+	require.EqualValues(t, storedNodes(t, m.db), storedNodes(t, db))
+
+	r, err = NewRestorer(db, root)
+	require.NoError(t, err)
+	require.True(t, r.Done())
+}
@@ -2,20 +2,26 @@ package merk
 
 import (
 	"github.com/valyala/bytebufferpool"
+	"sync"
 )
 
-// TODO: Make this option
-const DafaultLevels = 1
-
 type Commiter struct {
+	db     DB
 	wb     WriteBatch
 	height uint8
 	levels uint8
 	pool   bytebufferpool.Pool
+
+	workers *workers
+
+	mu      sync.Mutex
+	written map[Hash]bool
+	orphans []Hash   // previous hashes of rewritten nodes
+	reverts []func() // undo the changes to the tree when the commit fails
 }
 
-func newCommitter(b WriteBatch, h, l uint8) *Commiter {
-	return &Commiter{wb: b, height: h, levels: l}
+func newCommitter(db DB, b WriteBatch, h, l uint8, w *workers) *Commiter {
+	return &Commiter{db: db, wb: b, height: h, levels: l, workers: w, written: make(map[Hash]bool)}
 }
 
 func (c *Commiter) write(tree *Tree) error {
@@ -34,13 +40,39 @@ func (c *Commiter) write(tree *Tree) error {
 	value := make([]byte, len(buf.B))
 	copy(value, buf.B)
 
-	if err := c.wb.put(append(NodeKeyPrefix, key[:]...), value); err != nil {
+	if err := c.wb.Put(append(NodeKeyPrefix, key[:]...), value); err != nil {
 		return err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.written[key] = true
+	if tree.stored != NullHash && tree.stored != key {
+		c.orphans = append(c.orphans, tree.stored)
+	}
+
+	stored := tree.stored
+	c.reverts = append(c.reverts, func() { tree.stored = stored })
+	tree.stored = key
+
 	return nil
 }
 
+func (c *Commiter) onRevert(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reverts = append(c.reverts, f)
+}
+
+// revert undoes the changes to the tree, so the nodes are written again by the next commit
+func (c *Commiter) revert() {
+	for i := len(c.reverts) - 1; i >= 0; i-- {
+		c.reverts[i]()
+	}
+}
+
 func (c *Commiter) prune(tree *Tree) bool {
 	return c.height-tree.height() >= c.levels
 }
@@ -1,19 +1,22 @@
 package merk
 
 import (
+	"errors"
+	"fmt"
 	"io"
 )
 
-const (
-	DefaultDBDir = "../storage/merkdb"
-)
-
 var (
-	RootKey       = []byte(".root")
-	NodeKeyPrefix = []byte("@1:")
-	gDB           DB
+	RootKey           = []byte(".root")
+	NodeKeyPrefix     = []byte("@1:")
+	OrphanKeyPrefix   = []byte("@orphan:")
+	SnapshotKeyPrefix = []byte(".snapshot:")
+	VersionKeyPrefix  = []byte(".version:")
+	RestoreKey        = []byte(".restore")
 )
 
+// DB is the storage backend of Merk.
+// Implementations must return ErrNotFound from Get when the key does not exist.
 type DB interface {
 	io.Closer
 
@@ -21,24 +24,89 @@ type DB interface {
 
 	Dir() string
 
-	get(key []byte) ([]byte, error)
-	put(key, value []byte) error
-	delete(key []byte) error
-
-	newWriteBatch() WriteBatch
-	commitWriteBatch(batch WriteBatch) error
+	Get(key []byte) ([]byte, error)
+	Put(key, value []byte) error
+	Delete(key []byte) error
 
-	fetchTree(key []byte) (*Tree, error)
-	fetchTrees(key []byte) (*Tree, error)
+	NewWriteBatch() WriteBatch
+	CommitWriteBatch(batch WriteBatch) error
 
-	takeSnapshot() (Hash, error)
+	// Iterate calls fn for each key with the prefix in ascending order.
+	// Iteration stops at the first error returned by fn.
+	Iterate(prefix []byte, fn func(key, value []byte) error) error
 }
 
 type WriteBatch interface {
-	put(key, value []byte) error
-	delete(key []byte) error
+	Put(key, value []byte) error
+	Delete(key []byte) error
+
+	Cancel()
+}
+
+func fetchTree(db DB, key []byte) (*Tree, error) {
+	if key == nil {
+		return nil, errors.New("empty key while fetching tree")
+	}
+
+	if c, ok := db.(*cachedDB); ok {
+		return c.fetchTree(key)
+	}
+
+	return loadTree(db, key)
+}
+
+// loadTree reads the node from db bypassing the cache
+func loadTree(db DB, key []byte) (*Tree, error) {
+	value, err := db.Get(append(NodeKeyPrefix, key...))
+	if err != nil {
+		return nil, fmt.Errorf("failed get, %w", err)
+	}
+
+	t, err := unmarshalTree(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode node %x: %w", key, err)
+	}
+	t.db = db
+	copy(t.stored[:], key)
+
+	return t, nil
+}
+
+// fetchTrees loads the tree and its descendants down to the given levels,
+// deeper nodes are left as pruned links which are fetched on demand
+func fetchTrees(db DB, key []byte, levels uint8) (*Tree, error) {
+	var h Hash
+
+	tree, err := fetchTree(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if levels == 0 {
+		return tree, nil
+	}
+
+	handler := func(isLeft bool, l Link) error {
+		if l != nil {
+			h = l.Hash()
+			t, err := fetchTrees(db, h[:], levels-1)
+			if err != nil {
+				return err
+			}
+
+			tree.setLink(isLeft, l.intoStored(t))
+		}
+		return nil
+	}
+
+	if err := handler(true, tree.Link(true)); err != nil {
+		return nil, err
+	}
+	if err := handler(false, tree.Link(false)); err != nil {
+		return nil, err
+	}
 
-	cancel()
+	return tree, nil
 }
 
 type nullLog struct{}
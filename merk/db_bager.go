@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	badger "github.com/dgraph-io/badger/v2"
-	"github.com/dgraph-io/badger/v2/options"
 	"os"
 )
 
@@ -18,48 +17,31 @@ type badgerDB struct {
 	db  *badger.DB
 }
 
-func newBadger(dir string) (DB, error) {
-	if gDB != nil {
-		return nil, fmt.Errorf("db already open, dir: %v", gDB.Dir())
+func NewBadger(dir string, opts Options) (DB, error) {
+	if err := opts.validateBadger(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOptions, err)
 	}
 
-	if dir == "" {
-		dir = DefaultDBDir
-	}
-
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	ops, err := opts.badgerOptions(dir)
+	if err != nil {
 		return nil, err
 	}
 
-	ops := setBadgerOpts(dir)
+	if !opts.ReadOnly {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
 
 	db, err := badger.Open(ops)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open db: %w", err)
 	}
 
-	gDB = &badgerDB{ops.Dir, db}
-
-	return gDB, nil
-}
-
-func setBadgerOpts(dir string) badger.Options {
-	// See available options
-	// https://godoc.org/github.com/dgraph-io/badger#Options
-	ops := badger.DefaultOptions(dir)
-
-	// no logging
-	ops = ops.WithLogger(nullLog{})
-
-	// Explicitly specify compression
-	// Because the default compression with CGO is ZSTD, and without CGO it's Snappy.
-	ops = ops.WithCompression(options.Snappy)
-
-	return ops
+	return &badgerDB{ops.Dir, db}, nil
 }
 
 func (b *badgerDB) Close() error {
-	gDB = nil
 	return b.db.Close()
 }
 
@@ -67,7 +49,7 @@ func (b *badgerDB) Dir() string {
 	return b.dir
 }
 
-func (b *badgerDB) get(key []byte) ([]byte, error) {
+func (b *badgerDB) Get(key []byte) ([]byte, error) {
 	var value []byte
 
 	err := b.db.View(func(txn *badger.Txn) error {
@@ -80,6 +62,9 @@ func (b *badgerDB) get(key []byte) ([]byte, error) {
 		return err
 	})
 
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get from badger, %w", err)
 	}
@@ -87,13 +72,13 @@ func (b *badgerDB) get(key []byte) ([]byte, error) {
 	return value, err
 }
 
-func (b *badgerDB) put(key, value []byte) error {
+func (b *badgerDB) Put(key, value []byte) error {
 	return b.db.Update(func(txn *badger.Txn) error {
 		return txn.Set(key, value)
 	})
 }
 
-func (b *badgerDB) delete(key []byte) error {
+func (b *badgerDB) Delete(key []byte) error {
 	return b.db.Update(func(txn *badger.Txn) error {
 		return txn.Delete(key)
 	})
@@ -103,13 +88,13 @@ func (b *badgerDB) Destroy() error {
 	return b.db.DropAll()
 }
 
-func (b *badgerDB) newWriteBatch() WriteBatch {
+func (b *badgerDB) NewWriteBatch() WriteBatch {
 	return &badgerWriteBatch{
 		batch: b.db.NewWriteBatch(),
 	}
 }
 
-func (b *badgerDB) commitWriteBatch(batch WriteBatch) error {
+func (b *badgerDB) CommitWriteBatch(batch WriteBatch) error {
 	wb, ok := batch.(*badgerWriteBatch)
 	if !ok {
 		return errors.New("badger: not fed in a proper badger write batch")
@@ -118,93 +103,43 @@ func (b *badgerDB) commitWriteBatch(batch WriteBatch) error {
 	return wb.batch.Flush()
 }
 
-func (b *badgerDB) fetchTree(key []byte) (*Tree, error) {
-	if key == nil {
-		return nil, errors.New("empty key while fetching tree")
-	}
-
-	value, err := b.get(append(NodeKeyPrefix, key...))
-	if err != nil {
-		return nil, fmt.Errorf("failed get, %w", err)
-	}
-
-	t := unmarshalTree(value)
-
-	return t, nil
-}
+func (b *badgerDB) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	return b.db.View(func(txn *badger.Txn) error {
+		ops := badger.DefaultIteratorOptions
+		ops.Prefix = prefix
 
-func (b *badgerDB) fetchTrees(key []byte) (*Tree, error) {
-	var h Hash
+		it := txn.NewIterator(ops)
+		defer it.Close()
 
-	tree, err := b.fetchTree(key)
-	if err != nil {
-		return nil, err
-	}
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
 
-	handler := func(isLeft bool, l Link) error {
-		if l != nil {
-			h = l.Hash()
-			t, err := b.fetchTrees(h[:])
+			value, err := item.ValueCopy(nil)
 			if err != nil {
 				return err
 			}
 
-			tree.setLink(isLeft, l.intoStored(t))
+			if err := fn(item.KeyCopy(nil), value); err != nil {
+				return err
+			}
 		}
-		return nil
-	}
-
-	if err := handler(true, tree.Link(true)); err != nil {
-		return nil, err
-	}
-	if err := handler(false, tree.Link(false)); err != nil {
-		return nil, err
-	}
-
-	return tree, nil
-}
-
-func (b *badgerDB) takeSnapshot() (Hash, error) {
-	topKey, err := b.get(RootKey)
-	if err != nil {
-		return NullHash, fmt.Errorf("failed to get root key: %w", err)
-	}
 
-	tree, err := b.fetchTrees(topKey)
-	if err != nil {
-		return NullHash, fmt.Errorf("failed fetchTrees: %w", err)
-	}
-
-	wb := b.newWriteBatch()
-	defer wb.cancel()
-
-	committer := newCommitter(wb, 0, 0)
-	if err := tree.commitsSnapshot(committer); err != nil {
-		return NullHash, err
-	}
-
-	if err := b.commitWriteBatch(wb); err != nil {
-		return NullHash, err
-	}
-
-	var h Hash
-	copy(h[:], topKey)
-
-	return h, nil
+		return nil
+	})
 }
 
 type badgerWriteBatch struct {
 	batch *badger.WriteBatch
 }
 
-func (b *badgerWriteBatch) put(key, value []byte) error {
+func (b *badgerWriteBatch) Put(key, value []byte) error {
 	return b.batch.Set(key, value)
 }
 
-func (b *badgerWriteBatch) delete(key []byte) error {
+func (b *badgerWriteBatch) Delete(key []byte) error {
 	return b.batch.Delete(key)
 }
 
-func (b *badgerWriteBatch) cancel() {
+func (b *badgerWriteBatch) Cancel() {
 	b.batch.Cancel()
 }
@@ -0,0 +1,111 @@
+package merk
+
+import (
+	"bytes"
+	"sync/atomic"
+)
+
+var (
+	_ DB         = (*cachedDB)(nil)
+	_ WriteBatch = (*cachedWriteBatch)(nil)
+)
+
+// CacheStats counts the node fetches served by the cache and by db
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Nodes  int // number of the cached nodes
+}
+
+// cachedDB keeps the fetched nodes in the LRU cache, which is shared by everything fetching
+// pruned nodes through the Merk (Get, apply, iterators, proofs). Nodes are immutable as they are
+// stored by hash, so the cache is only invalidated when the nodes are deleted.
+type cachedDB struct {
+	DB
+
+	nodes  *nodeLRU
+	hits   uint64
+	misses uint64
+}
+
+func newCachedDB(db DB, size int) *cachedDB {
+	return &cachedDB{DB: db, nodes: newNodeLRU(size)}
+}
+
+// fetchTree returns the copy of the cached node, as the fetched nodes are modified by apply
+func (d *cachedDB) fetchTree(key []byte) (*Tree, error) {
+	var h Hash
+	copy(h[:], key)
+
+	if t, ok := d.nodes.Load(h); ok {
+		atomic.AddUint64(&d.hits, 1)
+		return t.clone(), nil
+	}
+
+	atomic.AddUint64(&d.misses, 1)
+
+	t, err := loadTree(d, key)
+	if err != nil {
+		return nil, err
+	}
+
+	d.nodes.Put(h, t.clone())
+
+	return t, nil
+}
+
+// CacheStats returns the statistics of the node cache, zero if the cache is disabled
+func (m *Merk) CacheStats() CacheStats {
+	if d, ok := m.db.(*cachedDB); ok {
+		return d.stats()
+	}
+	return CacheStats{}
+}
+
+func (d *cachedDB) stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&d.hits),
+		Misses: atomic.LoadUint64(&d.misses),
+		Nodes:  d.nodes.Len(),
+	}
+}
+
+// evict removes the node from the cache if the key is of a node
+func (d *cachedDB) evict(key []byte) {
+	if !bytes.HasPrefix(key, NodeKeyPrefix) {
+		return
+	}
+
+	var h Hash
+	copy(h[:], key[len(NodeKeyPrefix):])
+	d.nodes.Remove(h)
+}
+
+func (d *cachedDB) Delete(key []byte) error {
+	d.evict(key)
+	return d.DB.Delete(key)
+}
+
+func (d *cachedDB) NewWriteBatch() WriteBatch {
+	return &cachedWriteBatch{WriteBatch: d.DB.NewWriteBatch(), db: d}
+}
+
+func (d *cachedDB) CommitWriteBatch(batch WriteBatch) error {
+	if b, ok := batch.(*cachedWriteBatch); ok {
+		batch = b.WriteBatch
+	}
+	return d.DB.CommitWriteBatch(batch)
+}
+
+type cachedWriteBatch struct {
+	WriteBatch
+
+	db *cachedDB
+}
+
+// Delete evicts the node before the batch is committed, which only causes a cache miss
+// if the batch is cancelled
+func (b *cachedWriteBatch) Delete(key []byte) error {
+	b.db.evict(key)
+	return b.WriteBatch.Delete(key)
+}
@@ -0,0 +1,74 @@
+package merk
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNodeCache(t *testing.T) {
+	db := NewMemDB()
+
+	opts := DefaultOptions()
+	opts.Levels = 0
+	opts.KeepRecent = 0
+	opts.NodeCacheSize = 20
+
+	m, err := New(db, opts)
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value"), true)
+	require.NoError(t, err)
+	require.EqualValues(t, CacheStats{}, m.CacheStats())
+
+	require.EqualValues(t, []byte("value"), mustGet(t, m, []byte("key1003")))
+	stats := m.CacheStats()
+	require.Zero(t, stats.Hits)
+	require.True(t, stats.Misses > 0)
+
+	require.EqualValues(t, []byte("value"), mustGet(t, m, []byte("key1003")))
+	require.EqualValues(t, stats.Misses, m.CacheStats().Misses)
+	require.EqualValues(t, stats.Nodes, m.CacheStats().Hits)
+
+	// bounded by the size
+	it := m.Iterator(nil, nil)
+	for it.Next() {
+	}
+	require.NoError(t, it.Err())
+	require.EqualValues(t, 20, m.CacheStats().Nodes)
+
+	// modifying the fetched nodes leaves the cached ones
+	view, err := m.View()
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value2"), true)
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		key := buildSeqBatch(i, i+1, Put, "")[0].K
+		require.EqualValues(t, []byte("value"), mustGet(t, view, key))
+		require.EqualValues(t, []byte("value2"), mustGet(t, m, key))
+	}
+	require.NoError(t, view.Close())
+
+	// deleted nodes are evicted
+	m.opts.KeepRecent = 1
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value3"), true)
+	require.NoError(t, err)
+
+	cache := m.db.(*cachedDB).nodes
+	require.Zero(t, cache.Len())
+
+	require.EqualValues(t, []byte("value3"), mustGet(t, m, []byte("key1003")))
+	require.True(t, cache.Len() > 0)
+	for h := range cache.elements {
+		_, err := db.Get(append(NodeKeyPrefix, h[:]...))
+		require.NoError(t, err)
+	}
+
+	// disabled
+	opts.NodeCacheSize = 0
+	m, err = New(db, opts)
+	require.NoError(t, err)
+	require.EqualValues(t, []byte("value3"), mustGet(t, m, []byte("key1003")))
+	require.EqualValues(t, CacheStats{}, m.CacheStats())
+}
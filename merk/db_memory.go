@@ -0,0 +1,216 @@
+package merk
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	_ DB         = (*memDB)(nil)
+	_ WriteBatch = (*memWriteBatch)(nil)
+)
+
+// memDB is a DB which keeps everything in memory, useful for tests and ephemeral nodes
+type memDB struct {
+	sync.RWMutex
+
+	data map[string][]byte
+	keys []string // sorted keys of data, so Iterate seeks the prefix
+}
+
+func NewMemDB() DB {
+	return &memDB{data: make(map[string][]byte)}
+}
+
+func (d *memDB) Close() error {
+	return nil
+}
+
+func (d *memDB) Dir() string {
+	return ""
+}
+
+func (d *memDB) Get(key []byte) ([]byte, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	value, ok := d.data[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return copyBytes(value), nil
+}
+
+func (d *memDB) Put(key, value []byte) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if _, ok := d.data[string(key)]; !ok {
+		i := sort.SearchStrings(d.keys, string(key))
+		d.keys = append(d.keys, "")
+		copy(d.keys[i+1:], d.keys[i:])
+		d.keys[i] = string(key)
+	}
+
+	d.data[string(key)] = copyBytes(value)
+
+	return nil
+}
+
+func (d *memDB) Delete(key []byte) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if _, ok := d.data[string(key)]; ok {
+		i := sort.SearchStrings(d.keys, string(key))
+		d.keys = append(d.keys[:i], d.keys[i+1:]...)
+	}
+
+	delete(d.data, string(key))
+
+	return nil
+}
+
+func (d *memDB) Destroy() error {
+	d.Lock()
+	defer d.Unlock()
+
+	d.data = make(map[string][]byte)
+	d.keys = nil
+
+	return nil
+}
+
+func (d *memDB) NewWriteBatch() WriteBatch {
+	return &memWriteBatch{}
+}
+
+func (d *memDB) CommitWriteBatch(batch WriteBatch) error {
+	wb, ok := batch.(*memWriteBatch)
+	if !ok {
+		return errors.New("memdb: not fed in a proper memdb write batch")
+	}
+
+	wb.Lock()
+	defer wb.Unlock()
+
+	d.Lock()
+	defer d.Unlock()
+
+	var (
+		added   []string
+		removed bool
+	)
+
+	for _, op := range wb.ops {
+		_, ok := d.data[string(op.K)]
+		if op.O == Del {
+			delete(d.data, string(op.K))
+			removed = removed || ok
+		} else {
+			d.data[string(op.K)] = op.V
+			if !ok {
+				added = append(added, string(op.K))
+			}
+		}
+	}
+
+	wb.ops = nil
+
+	if len(added) > 0 || removed {
+		d.mergeKeys(added)
+	}
+
+	return nil
+}
+
+// mergeKeys merges the added keys into the index, and drops the deleted ones
+func (d *memDB) mergeKeys(added []string) {
+	sort.Strings(added)
+
+	keys := make([]string, 0, len(d.data))
+	appendKey := func(k string) {
+		if _, ok := d.data[k]; !ok {
+			return // deleted
+		}
+		if len(keys) > 0 && keys[len(keys)-1] == k {
+			return // added twice
+		}
+		keys = append(keys, k)
+	}
+
+	i, j := 0, 0
+	for i < len(d.keys) || j < len(added) {
+		if j == len(added) || (i < len(d.keys) && d.keys[i] <= added[j]) {
+			appendKey(d.keys[i])
+			i++
+		} else {
+			appendKey(added[j])
+			j++
+		}
+	}
+
+	d.keys = keys
+}
+
+func (d *memDB) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	var keys []string
+
+	d.RLock()
+	for i := sort.SearchStrings(d.keys, string(prefix)); i < len(d.keys); i++ {
+		if !strings.HasPrefix(d.keys[i], string(prefix)) {
+			break
+		}
+		keys = append(keys, d.keys[i])
+	}
+	d.RUnlock()
+
+	for _, k := range keys {
+		d.RLock()
+		value, ok := d.data[k]
+		d.RUnlock()
+
+		if !ok {
+			continue // deleted while iterating
+		}
+
+		if err := fn([]byte(k), copyBytes(value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// memWriteBatch is safe for concurrent use, as commitHandler writes from multiple goroutines
+type memWriteBatch struct {
+	sync.Mutex
+
+	ops []*OP
+}
+
+func (b *memWriteBatch) Put(key, value []byte) error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.ops = append(b.ops, &OP{O: Put, K: copyBytes(key), V: copyBytes(value)})
+	return nil
+}
+
+func (b *memWriteBatch) Delete(key []byte) error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.ops = append(b.ops, &OP{O: Del, K: copyBytes(key)})
+	return nil
+}
+
+func (b *memWriteBatch) Cancel() {
+	b.Lock()
+	defer b.Unlock()
+
+	b.ops = nil
+}
@@ -0,0 +1,70 @@
+package merk
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMemDB(t *testing.T) {
+	db := NewMemDB()
+	defer db.Close()
+
+	require.NoError(t, db.Put([]byte("key1"), []byte("value1")))
+	require.NoError(t, db.Put([]byte("key2"), []byte("value2")))
+
+	value, err := db.Get([]byte("key1"))
+	require.NoError(t, err)
+	require.EqualValues(t, []byte("value1"), value)
+
+	_, err = db.Get([]byte("key3"))
+	require.Equal(t, ErrNotFound, err)
+
+	wb := db.NewWriteBatch()
+	require.NoError(t, wb.Put([]byte("key3"), []byte("value3")))
+	require.NoError(t, wb.Delete([]byte("key1")))
+	require.NoError(t, db.CommitWriteBatch(wb))
+
+	_, err = db.Get([]byte("key1"))
+	require.Equal(t, ErrNotFound, err)
+
+	var keys, values [][]byte
+	err = db.Iterate([]byte("key"), func(key, value []byte) error {
+		keys = append(keys, key)
+		values = append(values, value)
+		return nil
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, [][]byte{[]byte("key2"), []byte("key3")}, keys)
+	require.EqualValues(t, [][]byte{[]byte("value2"), []byte("value3")}, values)
+
+	// the prefix is sought among the other keys
+	collect := func(prefix string) (keys []string) {
+		err := db.Iterate([]byte(prefix), func(key, value []byte) error {
+			keys = append(keys, string(key))
+			return nil
+		})
+		require.NoError(t, err)
+		return
+	}
+
+	wb = db.NewWriteBatch()
+	require.NoError(t, wb.Put([]byte("a"), nil))
+	require.NoError(t, wb.Put([]byte("key0"), nil))
+	require.NoError(t, wb.Delete([]byte("key0")))
+	require.NoError(t, wb.Delete([]byte("key3")))
+	require.NoError(t, wb.Put([]byte("key3"), nil))
+	require.NoError(t, wb.Put([]byte("kez"), nil))
+	require.NoError(t, db.CommitWriteBatch(wb))
+	require.NoError(t, db.Put([]byte("key1"), nil))
+	require.NoError(t, db.Put([]byte("key1"), nil))
+	require.NoError(t, db.Delete([]byte("key2")))
+
+	require.EqualValues(t, []string{"key1", "key3"}, collect("key"))
+	require.EqualValues(t, []string{"a", "key1", "key3", "kez"}, collect(""))
+	require.EqualValues(t, []string{"kez"}, collect("kez"))
+	require.Empty(t, collect("l"))
+
+	require.NoError(t, db.Destroy())
+	_, err = db.Get([]byte("key2"))
+	require.Equal(t, ErrNotFound, err)
+}
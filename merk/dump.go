@@ -0,0 +1,467 @@
+package merk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/lithdew/bytesutil"
+)
+
+// A dump is the key/values of a tree in key order. The shape of the tree, and so the root hash,
+// is not determined by the key/values alone, so each record has the depth of its node, 0 for the root.
+// It restores the exact tree, whose root hash is verified against the one in the header.
+//
+// JSON lines, keys and values in base64, the root hash in hex:
+// {"format":"merk-dump/1","root":"<root hash>"}
+// {"key":"a2V5MA==","value":"dmFsdWUw","depth":1}
+//
+// Binary, lengths in big endian:
+// header: "MERKDUMP" | format version(1) | root hash(32)
+// record: depth(1) | key length(4) | key | value length(4) | value
+
+type DumpFormat int
+
+const (
+	DumpJSON DumpFormat = iota
+	DumpBinary
+)
+
+const (
+	dumpJSONFormat    = "merk-dump/1"
+	dumpMagic         = "MERKDUMP"
+	dumpBinaryVersion = 1
+
+	importBatchSize = 10000 // nodes written per write batch
+)
+
+type dumpHeader struct {
+	Format string `json:"format"`
+	Root   string `json:"root"`
+}
+
+type dumpRecord struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	Depth uint8  `json:"depth"`
+}
+
+// Export writes the dump of the tree to w, e.g. of m.At(root) or m.View().
+// The nodes are fetched as they are written, so the tree is never entirely in memory.
+func (v *View) Export(w io.Writer, format DumpFormat) error {
+	bw := bufio.NewWriter(w)
+	root := v.RootHash()
+
+	var write func(depth uint8, t *Tree) error
+
+	switch format {
+	case DumpJSON:
+		enc := json.NewEncoder(bw)
+		if err := enc.Encode(&dumpHeader{Format: dumpJSONFormat, Root: hex.EncodeToString(root[:])}); err != nil {
+			return err
+		}
+
+		write = func(depth uint8, t *Tree) error {
+			return enc.Encode(&dumpRecord{Key: t.Key(), Value: t.Value(), Depth: depth})
+		}
+
+	case DumpBinary:
+		buf := append([]byte(dumpMagic), dumpBinaryVersion)
+		buf = append(buf, root[:]...)
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+
+		write = func(depth uint8, t *Tree) error {
+			buf = append(buf[:0], depth)
+			buf = bytesutil.AppendUint32BE(buf, uint32(len(t.Key())))
+			buf = append(buf, t.Key()...)
+			buf = bytesutil.AppendUint32BE(buf, uint32(len(t.Value())))
+			buf = append(buf, t.Value()...)
+			_, err := bw.Write(buf)
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unknown dump format, %v", format)
+	}
+
+	if err := exportTree(v.Tree, 0, write); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+func exportTree(t *Tree, depth uint8, write func(depth uint8, t *Tree) error) error {
+	if t == nil {
+		return nil
+	}
+
+	left, err := t.Child(true)
+	if err != nil {
+		return err
+	}
+	if err := exportTree(left, depth+1, write); err != nil {
+		return err
+	}
+
+	if err := write(depth, t); err != nil {
+		return err
+	}
+
+	right, err := t.Child(false)
+	if err != nil {
+		return err
+	}
+	return exportTree(right, depth+1, write)
+}
+
+// Import loads the dump, either format, into the Merk which has never been committed, and commits
+// it as version 1. The nodes are written as their subtrees complete, so the tree is never entirely
+// in memory. If the root hash does not match the header, the nodes are deleted and ErrDumpMismatch is returned.
+func (m *Merk) Import(r io.Reader) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.db == nil {
+		return ErrDBClosed
+	}
+
+	if m.opts.ReadOnly {
+		return ErrReadOnly
+	}
+
+	if m.Tree != nil || len(m.versions) > 0 {
+		return errors.New("cannot import into non-empty merk")
+	}
+
+	// the db must have no nodes, so the ones written are deleted on failure
+	found, err := hasPrefix(m.db, NodeKeyPrefix)
+	if err != nil {
+		return err
+	}
+	if found {
+		return errors.New("cannot import into db with nodes")
+	}
+
+	expected, next, err := newDumpReader(r)
+	if err != nil {
+		return err
+	}
+
+	im := &importer{db: m.db, wb: m.db.NewWriteBatch()}
+	committed := false
+	defer func() {
+		im.wb.Cancel()
+		if err != nil && !committed {
+			if cerr := deleteNodes(m.db); cerr != nil {
+				err = fmt.Errorf("%v, and failed to delete the imported nodes: %w", err, cerr)
+			}
+		}
+	}()
+
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := im.push(rec); err != nil {
+			return err
+		}
+	}
+
+	root, err := im.finish()
+	if err != nil {
+		return err
+	}
+
+	if root != expected {
+		return fmt.Errorf("%w, expected %x but got %x", ErrDumpMismatch, expected, root)
+	}
+
+	if root != NullHash {
+		if err := im.wb.Put(RootKey, root[:]); err != nil {
+			return err
+		}
+	}
+
+	version := m.version + 1
+
+	versions, _, err := m.writeVersion(im.wb, version, root)
+	if err != nil {
+		return err
+	}
+
+	if err := m.db.CommitWriteBatch(im.wb); err != nil {
+		return err
+	}
+	committed = true
+
+	m.pending = nil
+	m.version, m.versions = version, versions
+
+	if root == NullHash {
+		return nil // empty tree
+	}
+
+	tree, err := fetchTrees(m.db, root[:], m.opts.Levels)
+	if err != nil {
+		return fmt.Errorf("failed fetchTrees: %w", err)
+	}
+
+	m.Tree, m.committed = tree, tree
+
+	return nil
+}
+
+// newDumpReader reads the header, and returns the root hash in it and the reader of the records,
+// which returns io.EOF at the end
+func newDumpReader(r io.Reader) (Hash, func() (*dumpRecord, error), error) {
+	var root Hash
+
+	br := bufio.NewReader(r)
+
+	first, err := br.Peek(1)
+	if err != nil {
+		return root, nil, fmt.Errorf("%w: no header, %v", ErrMalformedDump, err)
+	}
+
+	if first[0] == '{' {
+		dec := json.NewDecoder(br)
+
+		var header dumpHeader
+		if err := dec.Decode(&header); err != nil {
+			return root, nil, fmt.Errorf("%w: %v", ErrMalformedDump, err)
+		}
+		if header.Format != dumpJSONFormat {
+			return root, nil, fmt.Errorf("%w: unknown format, %v", ErrMalformedDump, header.Format)
+		}
+
+		h, err := hex.DecodeString(header.Root)
+		if err != nil || len(h) != HashSize {
+			return root, nil, fmt.Errorf("%w: malformed root, %v", ErrMalformedDump, header.Root)
+		}
+		copy(root[:], h)
+
+		return root, func() (*dumpRecord, error) {
+			rec := &dumpRecord{}
+			if err := dec.Decode(rec); err != nil {
+				if err == io.EOF {
+					return nil, err
+				}
+				return nil, fmt.Errorf("%w: %v", ErrMalformedDump, err)
+			}
+			return rec, nil
+		}, nil
+	}
+
+	header := make([]byte, len(dumpMagic)+1+HashSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return root, nil, fmt.Errorf("%w: no header, %v", ErrMalformedDump, err)
+	}
+	if string(header[:len(dumpMagic)]) != dumpMagic {
+		return root, nil, fmt.Errorf("%w: unknown format", ErrMalformedDump)
+	}
+	if header[len(dumpMagic)] != dumpBinaryVersion {
+		return root, nil, fmt.Errorf("%w: unknown format version, %v", ErrMalformedDump, header[len(dumpMagic)])
+	}
+	copy(root[:], header[len(dumpMagic)+1:])
+
+	// the lengths are not trusted for allocation, so the bytes are read as they come
+	readLenPrefixed := func() ([]byte, error) {
+		var n [4]byte
+		if _, err := io.ReadFull(br, n[:]); err != nil {
+			return nil, err
+		}
+
+		size := int64(bytesutil.Uint32BE(n[:]))
+		b, err := ioutil.ReadAll(io.LimitReader(br, size))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(b)) != size {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return b, nil
+	}
+
+	return root, func() (*dumpRecord, error) {
+		depth, err := br.ReadByte()
+		if err != nil {
+			return nil, err // io.EOF at the end
+		}
+
+		rec := &dumpRecord{Depth: depth}
+		if rec.Key, err = readLenPrefixed(); err != nil {
+			return nil, fmt.Errorf("%w: truncated record, %v", ErrMalformedDump, err)
+		}
+		if rec.Value, err = readLenPrefixed(); err != nil {
+			return nil, fmt.Errorf("%w: truncated record, %v", ErrMalformedDump, err)
+		}
+		return rec, nil
+	}, nil
+}
+
+// importer rebuilds the tree from the records in key order. The stack is the right edge of the
+// nodes whose right subtrees are incomplete, deeper on the top. A record pops the deeper nodes,
+// which are complete and written, and the shallowest of them becomes its left child.
+type importer struct {
+	db    DB
+	wb    WriteBatch
+	size  int // nodes in wb
+	stack []*importItem
+	last  []byte // key of the last record
+}
+
+type importItem struct {
+	t     *Tree
+	depth uint8
+}
+
+func (im *importer) push(rec *dumpRecord) error {
+	if im.last != nil && bytes.Compare(rec.Key, im.last) <= 0 {
+		return fmt.Errorf("%w: keys must be ascending, %x after %x", ErrMalformedDump, rec.Key, im.last)
+	}
+	im.last = rec.Key
+
+	left, depth, err := im.pop(int(rec.Depth))
+	if err != nil {
+		return err
+	}
+
+	if left != nil && depth != int(rec.Depth)+1 {
+		return fmt.Errorf("%w: depth of %x", ErrMalformedDump, rec.Key)
+	}
+
+	if len(im.stack) > 0 && im.stack[len(im.stack)-1].depth == rec.Depth {
+		return fmt.Errorf("%w: depth of %x", ErrMalformedDump, rec.Key)
+	}
+
+	t := newTree(rec.Key, rec.Value)
+	if left != nil {
+		t.setLink(true, left)
+	}
+
+	im.stack = append(im.stack, &importItem{t: t, depth: rec.Depth})
+
+	return nil
+}
+
+// pop writes the nodes deeper than the depth, returns the link to the shallowest of them and its depth
+func (im *importer) pop(depth int) (*Pruned, int, error) {
+	var (
+		done      *Pruned
+		doneDepth = -1
+	)
+
+	for len(im.stack) > 0 && int(im.stack[len(im.stack)-1].depth) > depth {
+		item := im.stack[len(im.stack)-1]
+		im.stack = im.stack[:len(im.stack)-1]
+
+		if done != nil {
+			if doneDepth != int(item.depth)+1 {
+				return nil, 0, fmt.Errorf("%w: depth of %x", ErrMalformedDump, item.t.Key())
+			}
+			item.t.setLink(false, done)
+		}
+
+		// the hashes would match a dump of any shape, so the balance is checked here
+		if f := item.t.balanceFactor(); f < -1 || f > 1 {
+			return nil, 0, fmt.Errorf("%w: unbalanced at %x", ErrMalformedDump, item.t.Key())
+		}
+
+		h := item.t.Hash()
+		if err := im.write(h, item.t); err != nil {
+			return nil, 0, err
+		}
+
+		done = &Pruned{ch: item.t.ChildHeights(), k: item.t.Key(), h: h}
+		doneDepth = int(item.depth)
+	}
+
+	return done, doneDepth, nil
+}
+
+func (im *importer) write(h Hash, t *Tree) error {
+	if err := im.wb.Put(append(NodeKeyPrefix, h[:]...), t.marshal(nil)); err != nil {
+		return err
+	}
+
+	if im.size++; im.size < importBatchSize {
+		return nil
+	}
+
+	if err := im.db.CommitWriteBatch(im.wb); err != nil {
+		return err
+	}
+	im.wb.Cancel()
+
+	im.wb, im.size = im.db.NewWriteBatch(), 0
+
+	return nil
+}
+
+// finish writes the remaining nodes, returns the root hash
+func (im *importer) finish() (Hash, error) {
+	root, depth, err := im.pop(-1)
+	if err != nil {
+		return NullHash, err
+	}
+
+	if root == nil {
+		return NullHash, nil // empty dump
+	}
+
+	if depth != 0 {
+		return NullHash, fmt.Errorf("%w: no root", ErrMalformedDump)
+	}
+
+	return root.h, nil
+}
+
+// deleteNodes deletes all nodes, used when the import into the db without nodes failed
+func deleteNodes(db DB) error {
+	var keys [][]byte
+
+	err := db.Iterate(NodeKeyPrefix, func(key, value []byte) error {
+		keys = append(keys, append([]byte{}, key...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > importBatchSize {
+			n = importBatchSize
+		}
+
+		wb := db.NewWriteBatch()
+		for _, key := range keys[:n] {
+			if err := wb.Delete(key); err != nil {
+				wb.Cancel()
+				return err
+			}
+		}
+		err := db.CommitWriteBatch(wb)
+		wb.Cancel()
+		if err != nil {
+			return err
+		}
+
+		keys = keys[n:]
+	}
+
+	return nil
+}
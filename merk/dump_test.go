@@ -0,0 +1,145 @@
+package merk
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	m, err := New(NewMemDB(), DefaultOptions())
+	require.NoError(t, err)
+
+	// the shape differs from the tree built from a single batch
+	for i := 0; i < 10; i++ {
+		_, err = m.Apply(buildSeqBatch(i*50, i*50+60, Put, "value"+string(rune('a'+i))), true)
+		require.NoError(t, err)
+	}
+	_, err = m.Apply(buildSeqBatch(100, 200, Del, ""), true)
+	require.NoError(t, err)
+
+	view, err := m.View()
+	require.NoError(t, err)
+	defer view.Close()
+
+	for _, format := range []DumpFormat{DumpJSON, DumpBinary} {
+		var buf bytes.Buffer
+		require.NoError(t, view.Export(&buf, format))
+
+		db := NewMemDB()
+		imported, err := New(db, DefaultOptions())
+		require.NoError(t, err)
+		require.NoError(t, imported.Import(bytes.NewReader(buf.Bytes())))
+
+		require.EqualValues(t, m.RootHash(), imported.RootHash())
+		require.EqualValues(t, []uint64{1}, imported.Versions())
+		require.EqualValues(t, storedNodes(t, m.db), storedNodes(t, db))
+		require.EqualValues(t, []byte("valuej"), mustGet(t, imported, []byte("key1499")))
+		require.False(t, mustHas(t, imported, []byte("key1150")))
+
+		// loaded by New as well
+		reopened, err := New(db, DefaultOptions())
+		require.NoError(t, err)
+		require.EqualValues(t, m.RootHash(), reopened.RootHash())
+		require.NoError(t, reopened.Tree.verify())
+
+		// only into an empty merk
+		require.Error(t, imported.Import(bytes.NewReader(buf.Bytes())))
+	}
+
+	// empty tree
+	empty, err := New(NewMemDB(), DefaultOptions())
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, (&View{}).Export(&buf, DumpJSON))
+	require.NoError(t, empty.Import(&buf))
+	require.EqualValues(t, NullHash, empty.RootHash())
+	require.EqualValues(t, []uint64{1}, empty.Versions())
+}
+
+func TestImportErrors(t *testing.T) {
+	m, err := New(NewMemDB(), DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value"), true)
+	require.NoError(t, err)
+
+	view, err := m.View()
+	require.NoError(t, err)
+	defer view.Close()
+
+	var jsonDump, binaryDump bytes.Buffer
+	require.NoError(t, view.Export(&jsonDump, DumpJSON))
+	require.NoError(t, view.Export(&binaryDump, DumpBinary))
+
+	lines := strings.Split(strings.TrimSpace(jsonDump.String()), "\n")
+	bin := binaryDump.Bytes()
+
+	tampered := append([]byte{}, bin...)
+	tampered[len(tampered)-1] ^= 1
+
+	join := func(lines ...string) []byte {
+		return []byte(strings.Join(lines, "\n"))
+	}
+
+	// a right leaning chain, which hashes to the root as well
+	var chain *Tree
+	for i := 2; i >= 0; i-- {
+		t := newTree([]byte("key"+strconv.Itoa(i)), []byte("value"))
+		t.attach(false, chain)
+		chain = t
+	}
+	root := chain.Hash()
+	unbalanced := []string{`{"format":"merk-dump/1","root":"` + hex.EncodeToString(root[:]) + `"}`}
+	for i := 0; i < 3; i++ {
+		record, err := json.Marshal(dumpRecord{Key: []byte("key" + strconv.Itoa(i)), Value: []byte("value"), Depth: uint8(i)})
+		require.NoError(t, err)
+		unbalanced = append(unbalanced, string(record))
+	}
+
+	cases := map[string]struct {
+		dump     []byte
+		mismatch bool
+	}{
+		"tampered value":  {tampered, true},
+		"missing record":  {join(append([]string{lines[0]}, lines[2:]...)...), true},
+		"unordered":       {join(append([]string{lines[0], lines[2], lines[1]}, lines[3:]...)...), false},
+		"no root":         {[]byte(strings.Replace(jsonDump.String(), `"depth":0}`, `"depth":9}`, 1)), false},
+		"unbalanced":      {join(unbalanced...), false},
+		"truncated":       {bin[:len(bin)-3], false},
+		"no records":      {[]byte(lines[0]), true},
+		"unknown format":  {[]byte(`{"format":"other"}`), false},
+		"malformed root":  {[]byte(`{"format":"merk-dump/1","root":"00"}`), false},
+		"malformed magic": {append([]byte("MERKDUMQ"), bin[8:]...), false},
+		"empty":           {nil, false},
+	}
+
+	for name, c := range cases {
+		db := NewMemDB()
+		imported, err := New(db, DefaultOptions())
+		require.NoError(t, err)
+
+		err = imported.Import(bytes.NewReader(c.dump))
+		require.Error(t, err, name)
+		if c.mismatch {
+			require.True(t, errors.Is(err, ErrDumpMismatch), name)
+		} else {
+			require.True(t, errors.Is(err, ErrMalformedDump), name)
+		}
+
+		// nothing is left
+		require.Empty(t, storedNodes(t, db), name)
+		require.Nil(t, imported.Tree, name)
+		require.Empty(t, imported.Versions(), name)
+
+		require.NoError(t, imported.Import(bytes.NewReader(bin)), name)
+		require.EqualValues(t, m.RootHash(), imported.RootHash(), name)
+	}
+}
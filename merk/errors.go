@@ -0,0 +1,39 @@
+package merk
+
+import (
+	"errors"
+)
+
+// Errors are wrapped with the details, use errors.Is to branch
+var (
+	// ErrNotFound is returned by DB.Get when the key does not exist
+	ErrNotFound = errors.New("key not found")
+
+	ErrDBClosed       = errors.New("db is not open")
+	ErrReadOnly       = errors.New("merk is read only")
+	ErrInvalidOptions = errors.New("invalid options")
+	ErrEmptyTree      = errors.New("tree is empty")
+	ErrCorruptNode    = errors.New("corrupt node")
+	ErrLegacyFormat   = errors.New("tree is in legacy format, run Migrate")
+
+	// returned by Apply and DeleteRange
+	ErrEmptyBatch    = errors.New("empty batch")
+	ErrUnsortedBatch = errors.New("keys in batch must be sorted")
+	ErrDuplicateKey  = errors.New("keys in batch must be unique")
+	ErrTooLong       = errors.New("key or value is too long")
+	ErrUnknownOP     = errors.New("unknown op type")
+	ErrUnknownMerge  = errors.New("unknown merge function")
+	ErrDeleteMissing = errors.New("tried to delete non-existent key")
+	ErrInvalidRange  = errors.New("start of range must not be greater than end")
+
+	ErrVersionNotFound  = errors.New("version not found")
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+
+	// returned by Restorer
+	ErrMalformedChunk = errors.New("malformed chunk")
+	ErrChunkMismatch  = errors.New("chunk did not match expected hash")
+
+	// returned by Import
+	ErrMalformedDump = errors.New("malformed dump")
+	ErrDumpMismatch  = errors.New("dump did not match expected hash")
+)
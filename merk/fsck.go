@@ -0,0 +1,215 @@
+package merk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// IssueKind classifies the problems found by Check
+type IssueKind string
+
+const (
+	IssueMissing        IssueKind = "missing"         // the node is referenced but not stored
+	IssueCorrupt        IssueKind = "corrupt"         // the node cannot be decoded
+	IssueHashMismatch   IssueKind = "hash mismatch"   // the recomputed hash differs from the stored one
+	IssueUnordered      IssueKind = "unordered"       // the key is out of the range given by the ancestors
+	IssueUnbalanced     IssueKind = "unbalanced"      // the heights of the children differ by more than 1
+	IssueHeightMismatch IssueKind = "height mismatch" // the child heights in the link differ from the actual ones
+	IssueDanglingRoot   IssueKind = "dangling root"   // RootKey refers to a malformed or missing root
+	IssueCycle          IssueKind = "cycle"           // the node is linked more than once, e.g. by its descendant
+)
+
+type Issue struct {
+	Kind IssueKind
+	Hash Hash   // the node with the issue
+	Key  []byte // key of the node, nil if unreadable
+	Msg  string
+}
+
+func (i *Issue) String() string {
+	if i.Key == nil {
+		return fmt.Sprintf("%v node %x: %v", i.Kind, i.Hash, i.Msg)
+	}
+	return fmt.Sprintf("%v node %x (key %q): %v", i.Kind, i.Hash, i.Key, i.Msg)
+}
+
+// Report is the result of Check
+type Report struct {
+	Root   Hash
+	Nodes  int   // number of the nodes read
+	Height uint8 // height of the tree, excluding the unreadable subtrees
+	Issues []*Issue
+}
+
+// OK reports whether no issue is found
+func (r *Report) OK() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "root: %x\n", r.Root)
+	fmt.Fprintf(&b, "nodes: %v\n", r.Nodes)
+	fmt.Fprintf(&b, "height: %v\n", r.Height)
+	fmt.Fprintf(&b, "issues: %v\n", len(r.Issues))
+	for _, i := range r.Issues {
+		fmt.Fprintf(&b, "  %v\n", i)
+	}
+
+	return b.String()
+}
+
+// Check verifies the committed tree of the Merk, see CheckRoot
+func (m *Merk) Check() (*Report, error) {
+	if m.db == nil {
+		return nil, ErrDBClosed
+	}
+	return Check(m.db)
+}
+
+// Check verifies the tree stored under RootKey, see CheckRoot
+func Check(db DB) (*Report, error) {
+	value, err := db.Get(RootKey)
+	if errors.Is(err, ErrNotFound) {
+		return &Report{}, nil // empty tree
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get root: %w", err)
+	}
+
+	r := &Report{}
+
+	if len(value) != HashSize {
+		r.Issues = append(r.Issues, &Issue{Kind: IssueDanglingRoot, Msg: fmt.Sprintf("malformed root %x", value)})
+		return r, nil
+	}
+
+	copy(r.Root[:], value)
+
+	_, err = db.Get(append(append([]byte{}, NodeKeyPrefix...), value...))
+	if errors.Is(err, ErrNotFound) {
+		r.Issues = append(r.Issues, &Issue{Kind: IssueDanglingRoot, Hash: r.Root, Msg: "root node is not stored"})
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get root node %x: %w", r.Root, err)
+	}
+
+	return CheckRoot(db, r.Root)
+}
+
+// CheckRoot reads every node of the tree at the root from db bypassing the cache, recomputes
+// the hashes, and checks the key order, the AVL balance and the child heights recorded in links.
+// The problems are collected in the report, while the failures of db abort the check.
+func CheckRoot(db DB, root Hash) (*Report, error) {
+	c := &checker{db: db, report: &Report{Root: root}, visited: make(map[Hash]bool)}
+
+	if root == NullHash {
+		return c.report, nil
+	}
+
+	ch, _, err := c.check(root, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c.report.Height = 1 + max(ch[:])
+
+	return c.report, nil
+}
+
+type checker struct {
+	db      DB
+	report  *Report
+	visited map[Hash]bool
+}
+
+func (c *checker) add(kind IssueKind, h Hash, key []byte, format string, a ...interface{}) {
+	c.report.Issues = append(c.report.Issues, &Issue{Kind: kind, Hash: h, Key: key, Msg: fmt.Sprintf(format, a...)})
+}
+
+// check checks the subtree whose keys must be in (lo, hi), nil means unbounded.
+// Returns the actual child heights, which are unknown if any node of the subtree is unreadable.
+func (c *checker) check(h Hash, lo, hi []byte) ([2]uint8, bool, error) {
+	var heights [2]uint8
+
+	if c.visited[h] {
+		c.add(IssueCycle, h, nil, "node is linked more than once")
+		return heights, false, nil
+	}
+	c.visited[h] = true
+
+	value, err := c.db.Get(append(append([]byte{}, NodeKeyPrefix...), h[:]...))
+	if errors.Is(err, ErrNotFound) {
+		c.add(IssueMissing, h, nil, "node is not stored")
+		return heights, false, nil
+	}
+	if err != nil {
+		return heights, false, fmt.Errorf("failed to get node %x: %w", h, err)
+	}
+
+	c.report.Nodes++
+
+	t, err := unmarshalTree(value)
+	if err != nil {
+		c.add(IssueCorrupt, h, nil, "%v", err)
+		return heights, false, nil
+	}
+
+	actual := t.Hash()
+	if actual != h {
+		c.add(IssueHashMismatch, h, t.Key(), "recomputed hash is %x", actual)
+	}
+
+	if (lo != nil && bytes.Compare(t.Key(), lo) <= 0) || (hi != nil && bytes.Compare(t.Key(), hi) >= 0) {
+		c.add(IssueUnordered, h, t.Key(), "key is out of range (%q, %q)", lo, hi)
+	}
+
+	// the links of the tampered node are not trusted, e.g. may link to itself
+	if actual != h {
+		return heights, false, nil
+	}
+
+	// legacy nodes don't record child heights, see Migrate
+	legacy := value[0] != nodeFormatVersion
+	known := true
+
+	for i, isLeft := range []bool{true, false} {
+		l := t.Link(isLeft)
+		if l == nil {
+			continue
+		}
+
+		clo, chi := lo, hi
+		if isLeft {
+			chi = t.Key()
+		} else {
+			clo = t.Key()
+		}
+
+		ch, complete, err := c.check(l.Hash(), clo, chi)
+		if err != nil {
+			return heights, false, err
+		}
+
+		if !complete {
+			known = false
+			continue
+		}
+
+		heights[i] = 1 + max(ch[:])
+
+		if !legacy && ch != l.ChildHeights() {
+			c.add(IssueHeightMismatch, h, t.Key(), "%v link records child heights %v, actual %v", sideToStr(isLeft), l.ChildHeights(), ch)
+		}
+	}
+
+	if known && (heights[0] > heights[1]+1 || heights[1] > heights[0]+1) {
+		c.add(IssueUnbalanced, h, t.Key(), "child heights %v", heights)
+	}
+
+	return heights, known, nil
+}
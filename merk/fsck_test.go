@@ -0,0 +1,127 @@
+package merk
+
+import (
+	"errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	db := NewMemDB()
+
+	report, err := Check(db)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.EqualValues(t, NullHash, report.Root)
+
+	m, err := New(db, DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 200, Put, "value"), true)
+	require.NoError(t, err)
+
+	report, err = m.Check()
+	require.NoError(t, err)
+	require.True(t, report.OK(), report.String())
+	require.EqualValues(t, m.RootHash(), report.Root)
+	require.EqualValues(t, 200, report.Nodes)
+	require.EqualValues(t, m.Tree.height(), report.Height)
+
+	nodeKey := func(h Hash) []byte {
+		return append(append([]byte{}, NodeKeyPrefix...), h[:]...)
+	}
+
+	left, right := m.Tree.mustChild(true), m.Tree.mustChild(false)
+
+	// corrupt value
+	value, err := db.Get(nodeKey(left.Hash()))
+	require.NoError(t, err)
+	value[len(value)-1] ^= 1
+	require.NoError(t, db.Put(nodeKey(left.Hash()), value))
+
+	// truncated and missing nodes
+	value, err = db.Get(nodeKey(right.ChildHash(true)))
+	require.NoError(t, err)
+	require.NoError(t, db.Put(nodeKey(right.ChildHash(true)), value[:10]))
+	require.NoError(t, db.Delete(nodeKey(right.ChildHash(false))))
+
+	report, err = Check(db)
+	require.NoError(t, err)
+	require.False(t, report.OK())
+	require.Len(t, report.Issues, 3)
+	require.EqualValues(t, &Issue{Kind: IssueHashMismatch, Hash: left.Hash(), Key: left.Key(), Msg: report.Issues[0].Msg}, report.Issues[0])
+	require.EqualValues(t, IssueCorrupt, report.Issues[1].Kind)
+	require.EqualValues(t, right.ChildHash(true), report.Issues[1].Hash)
+	require.EqualValues(t, IssueMissing, report.Issues[2].Kind)
+	require.EqualValues(t, right.ChildHash(false), report.Issues[2].Hash)
+	require.Contains(t, report.String(), "issues: 3")
+
+	// links to itself and to the ancestor
+	root := m.RootHash()
+	for _, h := range []Hash{root, left.Hash()} {
+		value, err := db.Get(nodeKey(h))
+		require.NoError(t, err)
+		tree, err := unmarshalTree(value)
+		require.NoError(t, err)
+		tree.left = &Pruned{h: root, ch: tree.Link(true).ChildHeights()}
+		require.NoError(t, db.Put(nodeKey(h), tree.marshal(nil)))
+
+		report, err = CheckRoot(db, h)
+		require.NoError(t, err)
+		require.EqualValues(t, IssueHashMismatch, report.Issues[0].Kind)
+		require.EqualValues(t, h, report.Issues[0].Hash)
+	}
+
+	// dangling root
+	dangling := Hash{1}
+	require.NoError(t, db.Put(RootKey, dangling[:]))
+	report, err = Check(db)
+	require.NoError(t, err)
+	require.Len(t, report.Issues, 1)
+	require.EqualValues(t, IssueDanglingRoot, report.Issues[0].Kind)
+
+	// failures of db abort
+	_, err = Check(&faultyDB{DB: db, failGet: true})
+	require.True(t, errors.Is(err, errFault))
+}
+
+func TestCheckShape(t *testing.T) {
+	db := NewMemDB()
+
+	// put writes the node with the children, returns the link to it
+	var put func(key string, left, right *Pruned) *Pruned
+	put = func(key string, left, right *Pruned) *Pruned {
+		tree := newTree([]byte(key), []byte("value"))
+		if left != nil {
+			tree.left = left
+		}
+		if right != nil {
+			tree.right = right
+		}
+		h := tree.Hash()
+		require.NoError(t, db.Put(append(append([]byte{}, NodeKeyPrefix...), h[:]...), tree.marshal(nil)))
+		return &Pruned{ch: tree.ChildHeights(), h: h}
+	}
+
+	// 3 -> 2 -> 1 on the left, and 5 on the right of 1 out of order
+	root := put("3", put("2", put("1", nil, put("5", nil, nil)), nil), nil)
+
+	// wrong child heights recorded in the link
+	right := put("4", nil, nil)
+	right.ch = [2]uint8{1, 0}
+	root = put("0", nil, put("6", root, right))
+
+	report, err := CheckRoot(db, root.h)
+	require.NoError(t, err)
+	require.EqualValues(t, 7, report.Nodes)
+	require.EqualValues(t, 6, report.Height)
+
+	kinds := make(map[IssueKind][]string)
+	for _, i := range report.Issues {
+		kinds[i.Kind] = append(kinds[i.Kind], string(i.Key))
+	}
+
+	require.EqualValues(t, []string{"5", "4"}, kinds[IssueUnordered])
+	require.EqualValues(t, []string{"6", "0"}, kinds[IssueHeightMismatch])
+	require.EqualValues(t, []string{"2", "3", "6", "0"}, kinds[IssueUnbalanced])
+}
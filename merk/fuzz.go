@@ -1,3 +1,4 @@
+//go:build gofuzz
 // +build gofuzz
 
 package merk
@@ -5,16 +6,18 @@ package merk
 const storageDir string = "../storage/fuzz"
 
 func Fuzz(data []byte) int {
-	m, db, err := New(storageDir)
+	db, err := NewBadger(storageDir, DefaultOptions())
 	if err != nil {
-		if db != nil {
-			db.Close()
-		}
 		return 0
 	}
 
 	defer db.Close()
 
+	m, err := New(db, DefaultOptions())
+	if err != nil {
+		return 0
+	}
+
 	var batch Batch = []*OP{
 		&OP{O: Put, K: data, V: data},
 	}
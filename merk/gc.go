@@ -0,0 +1,259 @@
+package merk
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Nodes are stored by hash, so a node becomes an orphan when it's rewritten with new hash
+// or deleted from the tree. Orphans are deleted on commit, unless any root is pinned (e.g. snapshot,
+// retained version).
+// Then they are recorded as pending under OrphanKeyPrefix, and deleted by collectGarbage
+// once they are unreachable from all pinned roots.
+//
+// Pending orphans are never reachable from the live tree, so the nodes reachable from
+// pinned roots are either live or pending, and the subtree of a live node is entirely live.
+
+// pinnedRoots returns the roots kept besides the live tree
+func pinnedRoots(db DB) ([]Hash, error) {
+	var roots []Hash
+
+	err := db.Iterate(SnapshotKeyPrefix, func(key, value []byte) error {
+		var h Hash
+		copy(h[:], key[len(SnapshotKeyPrefix):])
+		roots = append(roots, h)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Iterate(VersionKeyPrefix, func(key, value []byte) error {
+		var h Hash
+		copy(h[:], value)
+		if h != NullHash {
+			roots = append(roots, h)
+		}
+		return nil
+	})
+
+	return roots, err
+}
+
+var errStopIteration = errors.New("stop iteration")
+
+func hasSnapshots(db DB) (bool, error) {
+	return hasPrefix(db, SnapshotKeyPrefix)
+}
+
+// hasPrefix reports whether any key has the prefix
+func hasPrefix(db DB, prefix []byte) (bool, error) {
+	found := false
+
+	err := db.Iterate(prefix, func(key, value []byte) error {
+		found = true
+		return errStopIteration
+	})
+	if errors.Is(err, errStopIteration) {
+		err = nil
+	}
+
+	return found, err
+}
+
+func pendingOrphans(db DB) (map[Hash]bool, error) {
+	pending := make(map[Hash]bool)
+
+	err := db.Iterate(OrphanKeyPrefix, func(key, value []byte) error {
+		var h Hash
+		copy(h[:], key[len(OrphanKeyPrefix):])
+		pending[h] = true
+		return nil
+	})
+
+	return pending, err
+}
+
+// writeOrphans deletes the orphans, or records them as pending if any root is pinned.
+// revived are pending orphans which became live again.
+func writeOrphans(db DB, wb WriteBatch, orphans []Hash, written map[Hash]bool, revived []Hash, pinned bool) error {
+	// written pending orphans are looked up by key, the pending set grows with the retained versions
+	for h := range written {
+		_, err := db.Get(append(OrphanKeyPrefix, h[:]...))
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		revived = append(revived, h)
+	}
+
+	// the revived are unmarked first, as they may have been orphaned again since
+	for _, h := range revived {
+		if err := wb.Delete(append(OrphanKeyPrefix, h[:]...)); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range orphans {
+		if written[h] {
+			continue // rewritten with the same content
+		}
+
+		var err error
+		if pinned {
+			err = wb.Put(append(OrphanKeyPrefix, h[:]...), []byte{})
+		} else {
+			err = wb.Delete(append(NodeKeyPrefix, h[:]...))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// collectGarbage deletes the pending orphans unreachable from the pinned roots and the roots
+// pinned in memory, see Merk.View
+func collectGarbage(db DB, views []Hash) error {
+	pending, err := pendingOrphans(db)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	roots, err := pinnedRoots(db)
+	if err != nil {
+		return err
+	}
+
+	roots = append(roots, views...)
+
+	// mark pending orphans reachable from the pinned roots
+	marked := make(map[Hash]bool)
+
+	var mark func(h Hash) error
+	mark = func(h Hash) error {
+		if !pending[h] || marked[h] {
+			return nil
+		}
+
+		marked[h] = true
+
+		return walkChildren(db, h, mark)
+	}
+
+	for _, root := range roots {
+		if err := mark(root); err != nil {
+			return fmt.Errorf("failed to mark root %v: %w", root, err)
+		}
+	}
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for h := range pending {
+		if marked[h] {
+			continue
+		}
+		if err := wb.Delete(append(NodeKeyPrefix, h[:]...)); err != nil {
+			return err
+		}
+		if err := wb.Delete(append(OrphanKeyPrefix, h[:]...)); err != nil {
+			return err
+		}
+	}
+
+	return db.CommitWriteBatch(wb)
+}
+
+// diffRoots returns the nodes reachable from the root from which are not reachable from the root to,
+// and the pending orphans reachable from the root to, when the live root changes from to.
+func diffRoots(db DB, from, to Hash) ([]Hash, []Hash, error) {
+	var orphans, revived []Hash
+
+	pending, err := pendingOrphans(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// nodes of to are either pending or live, so the walk stops at live nodes shared with from
+	shared := make(map[Hash]bool)
+
+	var walkTo func(h Hash) error
+	walkTo = func(h Hash) error {
+		if !pending[h] {
+			shared[h] = true
+			return nil
+		}
+
+		revived = append(revived, h)
+
+		return walkChildren(db, h, walkTo)
+	}
+
+	var walkFrom func(h Hash) error
+	walkFrom = func(h Hash) error {
+		if shared[h] {
+			return nil
+		}
+
+		orphans = append(orphans, h)
+
+		return walkChildren(db, h, walkFrom)
+	}
+
+	if to != NullHash {
+		if err := walkTo(to); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if from != NullHash {
+		if err := walkFrom(from); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return orphans, revived, nil
+}
+
+func walkChildren(db DB, h Hash, f func(h Hash) error) error {
+	t, err := fetchTree(db, h[:])
+	if err != nil {
+		return err
+	}
+
+	for _, l := range []Link{t.Link(true), t.Link(false)} {
+		if l == nil {
+			continue
+		}
+		if err := f(l.Hash()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storedRoot returns the root hash stored in db, NullHash if empty
+func storedRoot(db DB) (Hash, error) {
+	var h Hash
+
+	topKey, err := db.Get(RootKey)
+	if errors.Is(err, ErrNotFound) {
+		return NullHash, nil
+	}
+	if err != nil {
+		return NullHash, err
+	}
+
+	copy(h[:], topKey)
+
+	return h, nil
+}
@@ -0,0 +1,183 @@
+package merk
+
+import (
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+)
+
+func TestCommitDeletesOrphans(t *testing.T) {
+	db := NewMemDB()
+
+	m, err := New(db, DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value"), true)
+	require.NoError(t, err)
+	require.EqualValues(t, reachableNodes(t, db, m.RootHash()), storedNodes(t, db))
+
+	_, err = m.Apply(buildSeqBatch(50, 150, Put, "value2"), true)
+	require.NoError(t, err)
+	require.EqualValues(t, reachableNodes(t, db, m.RootHash()), storedNodes(t, db))
+
+	_, err = m.Apply(buildSeqBatch(0, 120, Del, ""), false)
+	require.NoError(t, err)
+	_, err = m.Apply(buildSeqBatch(0, 10, Put, "value3"), false)
+	require.NoError(t, err)
+	require.NoError(t, m.Commit())
+	require.EqualValues(t, reachableNodes(t, db, m.RootHash()), storedNodes(t, db))
+	require.Len(t, storedNodes(t, db), 40)
+
+	_, err = m.Apply(append(buildSeqBatch(0, 10, Del, ""), buildSeqBatch(120, 150, Del, "")...), true)
+	require.NoError(t, err)
+	require.Nil(t, m.Tree)
+	require.Empty(t, storedNodes(t, db))
+}
+
+func TestCommitKeepsSnapshotNodes(t *testing.T) {
+	db := NewMemDB()
+
+	m, err := New(db, DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value"), true)
+	require.NoError(t, err)
+
+	snapshotKey, err := m.TakeDBSnapshot()
+	require.NoError(t, err)
+
+	live := func() map[Hash]bool {
+		nodes := reachableNodes(t, db, m.RootHash())
+		for h := range reachableNodes(t, db, snapshotKey) {
+			nodes[h] = true
+		}
+		return nodes
+	}
+
+	_, err = m.Apply(buildSeqBatch(50, 150, Put, "value2"), true)
+	require.NoError(t, err)
+	require.EqualValues(t, live(), storedNodes(t, db))
+
+	_, err = m.Apply(buildSeqBatch(60, 70, Put, "value3"), true)
+	require.NoError(t, err)
+	require.EqualValues(t, live(), storedNodes(t, db))
+
+	_, err = m.Apply(buildSeqBatch(0, 80, Del, ""), true)
+	require.NoError(t, err)
+	require.EqualValues(t, live(), storedNodes(t, db))
+
+	require.NoError(t, m.Revert(snapshotKey))
+	require.NoError(t, m.Commit())
+	require.EqualValues(t, snapshotKey, m.RootHash())
+	require.EqualValues(t, reachableNodes(t, db, snapshotKey), storedNodes(t, db))
+
+	it := m.Iterator(nil, nil)
+	defer it.Close()
+	for i := 0; i < 100; i++ {
+		require.True(t, it.Next())
+		require.EqualValues(t, []byte("value"), it.Value())
+	}
+
+	_, err = m.Apply(buildSeqBatch(0, 10, Put, "value4"), true)
+	require.NoError(t, err)
+	require.EqualValues(t, live(), storedNodes(t, db))
+}
+
+func buildSeqBatch(from, to int, o OPType, value string) (batch Batch) {
+	for i := from; i < to; i++ {
+		batch = append(batch, &OP{O: o, K: []byte("key" + strconv.Itoa(1000+i)), V: []byte(value)})
+	}
+	return
+}
+
+func TestOrphanRevivedNodes(t *testing.T) {
+	db := NewMemDB()
+
+	opts := DefaultOptions()
+	opts.KeepRecent = 0
+
+	m, err := New(db, opts)
+	require.NoError(t, err)
+
+	for i := 1; i <= 3; i++ {
+		_, err = m.Apply(buildSeqBatch(0, 20*i, Put, "value"+strconv.Itoa(i)), true)
+		require.NoError(t, err)
+	}
+
+	live := func() map[Hash]bool {
+		nodes := reachableNodes(t, db, m.RootHash())
+		for _, v := range m.Versions() {
+			view, err := m.AtVersion(v)
+			require.NoError(t, err)
+			for h := range reachableNodes(t, db, view.RootHash()) {
+				nodes[h] = true
+			}
+		}
+		snapshots, err := m.Snapshots()
+		require.NoError(t, err)
+		for _, s := range snapshots {
+			for h := range reachableNodes(t, db, s.Root) {
+				nodes[h] = true
+			}
+		}
+		return nodes
+	}
+
+	// the apply replaces the nodes revived by LoadVersion
+	require.NoError(t, m.LoadVersion(1))
+	_, err = m.Apply(buildSeqBatch(0, 1, Put, "value4"), true)
+	require.NoError(t, err)
+	require.EqualValues(t, live(), storedNodes(t, db))
+
+	m.opts.KeepRecent = 1
+	_, err = m.Apply(buildSeqBatch(1, 2, Put, "value5"), true)
+	require.NoError(t, err)
+	require.EqualValues(t, live(), storedNodes(t, db))
+
+	// and the ones revived by Revert
+	snapshotKey, err := m.TakeDBSnapshot()
+	require.NoError(t, err)
+	_, err = m.Apply(buildSeqBatch(0, 20, Put, "value6"), true)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Revert(snapshotKey))
+	_, err = m.Apply(buildSeqBatch(2, 3, Put, "value7"), true)
+	require.NoError(t, err)
+	require.EqualValues(t, live(), storedNodes(t, db))
+
+	require.NoError(t, m.ReleaseSnapshot(snapshotKey))
+	_, err = m.Apply(buildSeqBatch(3, 4, Put, "value8"), true)
+	require.NoError(t, err)
+	require.EqualValues(t, reachableNodes(t, db, m.RootHash()), storedNodes(t, db))
+	require.EqualValues(t, []byte("value1"), mustGet(t, m, []byte("key1019")))
+}
+
+func reachableNodes(t *testing.T, db DB, root Hash) map[Hash]bool {
+	nodes := make(map[Hash]bool)
+
+	var walk func(h Hash) error
+	walk = func(h Hash) error {
+		nodes[h] = true
+		return walkChildren(db, h, walk)
+	}
+
+	if root != NullHash {
+		require.NoError(t, walk(root))
+	}
+
+	return nodes
+}
+
+func storedNodes(t *testing.T, db DB) map[Hash]bool {
+	nodes := make(map[Hash]bool)
+
+	err := db.Iterate(NodeKeyPrefix, func(key, value []byte) error {
+		var h Hash
+		copy(h[:], key[len(NodeKeyPrefix):])
+		nodes[h] = true
+		return nil
+	})
+	require.NoError(t, err)
+
+	return nodes
+}
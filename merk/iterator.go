@@ -0,0 +1,153 @@
+package merk
+
+import (
+	"bytes"
+)
+
+// Iterator walks key/values of a tree in order within [start, end).
+// Pruned nodes are fetched from db as the iterator reaches them.
+//
+//	it := m.Iterator(start, end)
+//	defer it.Close()
+//	for it.Next() {
+//		key, value := it.Key(), it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	start   []byte
+	end     []byte
+	reverse bool
+
+	stack []*Tree
+	cur   *Tree
+	err   error // failure to fetch a node, which stops the iteration
+}
+
+// Iterator returns an ascending iterator over [start, end), nil means unbounded.
+// The iterator must not be used while writing, iterate a View instead.
+func (m *Merk) Iterator(start, end []byte) *Iterator {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return newIterator(m.Tree, start, end, false)
+}
+
+// ReverseIterator returns a descending iterator over [start, end), nil means unbounded.
+// The iterator must not be used while writing, iterate a View instead.
+func (m *Merk) ReverseIterator(start, end []byte) *Iterator {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return newIterator(m.Tree, start, end, true)
+}
+
+// Iterator returns an ascending iterator over [start, end) of the tree, nil means unbounded
+func (t *Tree) Iterator(start, end []byte) *Iterator {
+	return newIterator(t, start, end, false)
+}
+
+// ReverseIterator returns a descending iterator over [start, end) of the tree, nil means unbounded
+func (t *Tree) ReverseIterator(start, end []byte) *Iterator {
+	return newIterator(t, start, end, true)
+}
+
+func newIterator(tree *Tree, start, end []byte, reverse bool) *Iterator {
+	it := &Iterator{start: start, end: end, reverse: reverse}
+
+	it.pushEdge(tree)
+
+	return it
+}
+
+// Next moves to the next key, returns false when the iteration finished or failed
+func (it *Iterator) Next() bool {
+	if it.err != nil || len(it.stack) == 0 {
+		it.cur = nil
+		return false
+	}
+
+	it.cur, it.stack = it.stack[len(it.stack)-1], it.stack[:len(it.stack)-1]
+
+	if !it.inRange(it.cur.Key()) {
+		it.Close()
+		return false
+	}
+
+	child, err := it.cur.Child(it.reverse)
+	if err != nil {
+		it.fail(err)
+		return false
+	}
+
+	it.pushEdge(child)
+	if it.err != nil {
+		return false
+	}
+
+	return true
+}
+
+func (it *Iterator) Key() []byte {
+	if it.cur == nil {
+		return nil
+	}
+	return it.cur.Key()
+}
+
+func (it *Iterator) Value() []byte {
+	if it.cur == nil {
+		return nil
+	}
+	return it.cur.Value()
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Close releases the nodes held by the iterator
+func (it *Iterator) Close() {
+	it.stack = nil
+	it.cur = nil
+}
+
+func (it *Iterator) fail(err error) {
+	it.Close()
+	it.err = err
+}
+
+// pushEdge pushes the nodes on the path to the first key of the tree in iteration order,
+// skipping the subtrees before the range
+func (it *Iterator) pushEdge(tree *Tree) {
+	var err error
+	for tree != nil {
+		if it.beforeRange(tree.Key()) {
+			tree, err = tree.Child(it.reverse)
+		} else {
+			it.stack = append(it.stack, tree)
+			tree, err = tree.Child(!it.reverse)
+		}
+
+		if err != nil {
+			it.fail(err)
+			return
+		}
+	}
+}
+
+func (it *Iterator) beforeRange(key []byte) bool {
+	if it.reverse {
+		return it.end != nil && bytes.Compare(key, it.end) >= 0
+	}
+	return it.start != nil && bytes.Compare(key, it.start) < 0
+}
+
+func (it *Iterator) inRange(key []byte) bool {
+	if it.start != nil && bytes.Compare(key, it.start) < 0 {
+		return false
+	}
+	return it.end == nil || bytes.Compare(key, it.end) < 0
+}
@@ -0,0 +1,58 @@
+package merk
+
+import (
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+)
+
+func TestIterator(t *testing.T) {
+	m, db := buildMerkWithDB()
+	defer db.Close()
+	defer db.Destroy()
+
+	opts := DefaultOptions()
+	opts.Levels = 0
+
+	// reload, so that most of nodes are pruned
+	m, err := New(db, opts)
+	require.NoError(t, err)
+
+	collect := func(it *Iterator) (keys []string) {
+		defer it.Close()
+		for it.Next() {
+			require.EqualValues(t, "value"+string(it.Key()[3:]), string(it.Value()))
+			keys = append(keys, string(it.Key()))
+		}
+		return
+	}
+
+	var all []string
+	for i := 0; i < 10; i++ {
+		all = append(all, "key"+strconv.Itoa(i))
+	}
+
+	require.EqualValues(t, all, collect(m.Iterator(nil, nil)))
+	require.EqualValues(t, all[3:7], collect(m.Iterator([]byte("key3"), []byte("key7"))))
+	require.EqualValues(t, all[3:7], collect(m.Iterator([]byte("key21"), []byte("key61"))))
+	require.EqualValues(t, all[8:], collect(m.Iterator([]byte("key8"), nil)))
+	require.EqualValues(t, all[:2], collect(m.Iterator(nil, []byte("key2"))))
+	require.Empty(t, collect(m.Iterator([]byte("key5"), []byte("key5"))))
+	require.Empty(t, collect(m.Iterator([]byte("key91"), nil)))
+
+	reverse := func(keys []string) (r []string) {
+		for i := len(keys) - 1; i >= 0; i-- {
+			r = append(r, keys[i])
+		}
+		return
+	}
+
+	require.EqualValues(t, reverse(all), collect(m.ReverseIterator(nil, nil)))
+	require.EqualValues(t, reverse(all[3:7]), collect(m.ReverseIterator([]byte("key3"), []byte("key7"))))
+	require.EqualValues(t, reverse(all[3:7]), collect(m.ReverseIterator([]byte("key21"), []byte("key61"))))
+	require.EqualValues(t, reverse(all[8:]), collect(m.ReverseIterator([]byte("key8"), nil)))
+	require.EqualValues(t, reverse(all[:2]), collect(m.ReverseIterator(nil, []byte("key2"))))
+	require.Empty(t, collect(m.ReverseIterator(nil, []byte("key0"))))
+
+	require.Empty(t, collect((&Merk{}).Iterator(nil, nil)))
+}
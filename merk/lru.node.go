@@ -0,0 +1,84 @@
+package merk
+
+import (
+	"container/list"
+	"sync"
+)
+
+// nodeLRU keeps the recently fetched nodes by hash, see cachedDB
+type nodeLRU struct {
+	sync.Mutex
+
+	size int
+
+	elements map[Hash]*list.Element
+	access   *list.List
+}
+
+type objectInfoNode struct {
+	key Hash
+	obj *Tree
+}
+
+func newNodeLRU(size int) *nodeLRU {
+	return &nodeLRU{
+		size:     size,
+		elements: make(map[Hash]*list.Element, size),
+		access:   list.New(),
+	}
+}
+
+func (l *nodeLRU) Load(key Hash) (*Tree, bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	elem, ok := l.elements[key]
+	if !ok {
+		return nil, false
+	}
+
+	l.access.MoveToFront(elem)
+
+	return elem.Value.(*objectInfoNode).obj, ok
+}
+
+func (l *nodeLRU) Put(key Hash, val *Tree) {
+	l.Lock()
+	defer l.Unlock()
+
+	elem, ok := l.elements[key]
+
+	if ok {
+		elem.Value.(*objectInfoNode).obj = val
+		l.access.MoveToFront(elem)
+	} else {
+		l.elements[key] = l.access.PushFront(&objectInfoNode{
+			key: key,
+			obj: val,
+		})
+		for len(l.elements) > l.size {
+			back := l.access.Back()
+			info := back.Value.(*objectInfoNode)
+			delete(l.elements, info.key)
+			l.access.Remove(back)
+		}
+	}
+}
+
+func (l *nodeLRU) Remove(key Hash) {
+	l.Lock()
+	defer l.Unlock()
+
+	elem, ok := l.elements[key]
+	if ok {
+		delete(l.elements, key)
+		l.access.Remove(elem)
+	}
+}
+
+func (l *nodeLRU) Len() int {
+	l.Lock()
+	defer l.Unlock()
+
+	return len(l.elements)
+}
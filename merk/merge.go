@@ -0,0 +1,86 @@
+package merk
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lithdew/bytesutil"
+	"sync"
+)
+
+// Names of the builtin merge functions
+const (
+	MergeUint64Add = "uint64add" // adds the uint64 big-endian operand to the value
+	MergeAppend    = "append"    // appends the operand to the value
+)
+
+// MergeFunc combines the existing value with the operand of Merge op, found is false if the key is absent
+type MergeFunc func(existing []byte, found bool, operand []byte) ([]byte, error)
+
+var mergeFuncs = struct {
+	sync.RWMutex
+	m map[string]MergeFunc
+}{
+	m: map[string]MergeFunc{
+		MergeUint64Add: mergeUint64Add,
+		MergeAppend:    mergeAppend,
+	},
+}
+
+// RegisterMergeFunc registers the merge function used by Merge ops with the name
+func RegisterMergeFunc(name string, f MergeFunc) error {
+	if f == nil {
+		return errors.New("merge function is nil")
+	}
+
+	mergeFuncs.Lock()
+	defer mergeFuncs.Unlock()
+
+	if _, ok := mergeFuncs.m[name]; ok {
+		return fmt.Errorf("merge function is already registered, %v", name)
+	}
+
+	mergeFuncs.m[name] = f
+
+	return nil
+}
+
+func lookupMergeFunc(name string) (MergeFunc, bool) {
+	mergeFuncs.RLock()
+	defer mergeFuncs.RUnlock()
+
+	f, ok := mergeFuncs.m[name]
+	return f, ok
+}
+
+// merge returns the value of the key after the Merge op
+func merge(op *OP, existing []byte, found bool) ([]byte, error) {
+	f, ok := lookupMergeFunc(op.M)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownMerge, op.M)
+	}
+
+	value, err := f(existing, found, op.V)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge %v: %w", op.K, err)
+	}
+
+	return value, nil
+}
+
+func mergeUint64Add(existing []byte, found bool, operand []byte) ([]byte, error) {
+	if len(operand) != 8 || (found && len(existing) != 8) {
+		return nil, errors.New("uint64add requires 8 bytes values")
+	}
+
+	var sum uint64 = bytesutil.Uint64BE(operand)
+	if found {
+		sum += bytesutil.Uint64BE(existing)
+	}
+
+	return bytesutil.AppendUint64BE(nil, sum), nil
+}
+
+func mergeAppend(existing []byte, found bool, operand []byte) ([]byte, error) {
+	value := make([]byte, 0, len(existing)+len(operand))
+	return append(append(value, existing...), operand...), nil
+}
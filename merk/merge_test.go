@@ -0,0 +1,102 @@
+package merk
+
+import (
+	"bytes"
+	"errors"
+	"github.com/lithdew/bytesutil"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	m, err := New(NewMemDB(), DefaultOptions())
+	require.NoError(t, err)
+
+	one := bytesutil.AppendUint64BE(nil, 1)
+
+	for i := 0; i < 3; i++ {
+		var batch Batch = []*OP{
+			&OP{O: Merge, K: []byte("counter"), V: one, M: MergeUint64Add},
+			&OP{O: Merge, K: []byte("list"), V: []byte{byte(i)}, M: MergeAppend},
+			&OP{O: Put, K: []byte("other"), V: []byte("value")},
+		}
+		_, err = m.Apply(batch, true)
+		require.NoError(t, err)
+		require.True(t, batch[0].Applied())
+	}
+
+	require.EqualValues(t, bytesutil.AppendUint64BE(nil, 3), mustGet(t, m, []byte("counter")))
+	require.EqualValues(t, []byte{0, 1, 2}, mustGet(t, m, []byte("list")))
+
+	// merge error aborts the apply
+	var batch Batch = []*OP{&OP{O: Merge, K: []byte("list"), V: one, M: MergeUint64Add}}
+	_, err = m.Apply(batch, true)
+	require.Error(t, err)
+
+	batch = []*OP{&OP{O: Merge, K: []byte("list"), V: one, M: "unknown"}}
+	_, err = m.Apply(batch, true)
+	require.Error(t, err)
+}
+
+func TestMergeEmptyValue(t *testing.T) {
+	db := NewMemDB()
+
+	m, err := New(db, DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.Apply(Batch{&OP{O: Put, K: []byte("counter"), V: nil}}, true)
+	require.NoError(t, err)
+
+	one := bytesutil.AppendUint64BE(nil, 1)
+
+	// the empty value is present whether built in memory or loaded from db
+	batch := Batch{&OP{O: Merge, K: []byte("counter"), V: one, M: MergeUint64Add}}
+	_, err = m.Apply(batch, false)
+	require.Error(t, err)
+
+	reopened, err := New(db, DefaultOptions())
+	require.NoError(t, err)
+	_, err = reopened.Apply(batch, false)
+	require.Error(t, err)
+
+	batch = Batch{&OP{O: Merge, K: []byte("counter"), V: []byte("a"), M: MergeAppend}}
+	_, err = reopened.Apply(batch, true)
+	require.NoError(t, err)
+	require.EqualValues(t, []byte("a"), mustGet(t, reopened, []byte("counter")))
+}
+
+func TestRegisterMergeFunc(t *testing.T) {
+	max := func(existing []byte, found bool, operand []byte) ([]byte, error) {
+		if !found {
+			return nil, errors.New("absent")
+		}
+		if bytes.Compare(existing, operand) > 0 {
+			return existing, nil
+		}
+		return operand, nil
+	}
+
+	require.NoError(t, RegisterMergeFunc("test-max", max))
+	require.Error(t, RegisterMergeFunc("test-max", max))
+	require.Error(t, RegisterMergeFunc(MergeAppend, max))
+	require.Error(t, RegisterMergeFunc("test-nil", nil))
+
+	m, err := New(NewMemDB(), DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 3, Put, "b"), true)
+	require.NoError(t, err)
+
+	var batch Batch = []*OP{
+		&OP{O: Merge, K: []byte("key1000"), V: []byte("a"), M: "test-max"},
+		&OP{O: Merge, K: []byte("key1001"), V: []byte("c"), M: "test-max"},
+	}
+	_, err = m.Apply(batch, true)
+	require.NoError(t, err)
+	require.EqualValues(t, []byte("b"), mustGet(t, m, []byte("key1000")))
+	require.EqualValues(t, []byte("c"), mustGet(t, m, []byte("key1001")))
+
+	batch = []*OP{&OP{O: Merge, K: []byte("key2000"), V: []byte("a"), M: "test-max"}}
+	_, err = m.Apply(batch, true)
+	require.Error(t, err)
+}
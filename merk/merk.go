@@ -5,48 +5,121 @@ import (
 	"errors"
 	"fmt"
 	"math"
-	"strings"
+	"sync"
 )
 
+// Merk is safe for concurrent use by many readers and one writer at a time. Reads of the live tree
+// wait for the write in progress, while a View reads the committed tree without waiting.
+// Tree must not be accessed directly while writing.
 type Merk struct {
 	Tree *Tree
+	db   DB
+	opts Options
+
+	workers *workers // bounds the goroutines of apply and commit
+	legacy  bool     // the read only tree is in legacy format, which disallows apply
+
+	mu        sync.RWMutex
+	committed *Tree // root as of the last commit, which is never modified so shared with views
+
+	pinMu sync.Mutex
+	pins  map[Hash]int  // roots read by the open views, kept from garbage collection
+	gc    map[Hash]bool // pinned roots which kept orphans pending, collected on the last unpin
+
+	orphans []Hash   // stored nodes removed from the tree since the last commit
+	revived []Hash   // pending orphans which became live again by Revert
+	pending [][]byte // keys written since the last commit, see Pending
+
+	version  uint64   // version of the tree, the next commit is version+1
+	versions []uint64 // retained versions in ascending order
 }
 
-func New(dir string) (*Merk, DB, error) {
-	db, err := newBadger(dir)
+// New loads the tree stored in the db, e.g. NewBadger(dir, opts) or NewMemDB()
+func New(db DB, opts Options) (*Merk, error) {
+	if db == nil {
+		return nil, fmt.Errorf("%w: db is nil", ErrDBClosed)
+	}
+
+	if err := opts.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOptions, err)
+	}
+
+	if opts.NodeCacheSize > 0 {
+		db = newCachedDB(db, opts.NodeCacheSize)
+	}
+
+	m := &Merk{db: db, opts: opts, workers: newWorkers(opts)}
+
+	// the child heights of legacy nodes are unknown, so apply would balance the tree wrongly
+	legacy, err := legacyRoots(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check format: %w", err)
+	}
+
+	if len(legacy) > 0 {
+		if opts.ReadOnly {
+			m.legacy = true
+		} else if err := Migrate(db, legacy...); err != nil {
+			return nil, fmt.Errorf("failed to migrate: %w", err)
+		}
+	}
+
+	versions, err := loadVersions(db)
 	if err != nil {
-		return nil, db, fmt.Errorf("failed to open db: %w", err)
+		return nil, fmt.Errorf("failed to load versions: %w", err)
+	}
+
+	if len(versions) > 0 {
+		m.version, m.versions = versions[len(versions)-1], versions
 	}
 
-	topKey, err := db.get(RootKey)
+	topKey, err := db.Get(RootKey)
 	if err != nil {
-		if strings.Contains(err.Error(), "Key not found") {
-			return &Merk{}, db, nil
+		if errors.Is(err, ErrNotFound) {
+			return m, nil
 		}
-		return nil, db, err
+		return nil, err
 	}
 
-	tree, err := db.fetchTrees(topKey)
+	m.Tree, err = fetchTrees(db, topKey, opts.Levels)
 	if err != nil {
-		return nil, db, fmt.Errorf("failed fetchTrees: %w", err)
+		return nil, fmt.Errorf("failed fetchTrees: %w", err)
 	}
 
-	return &Merk{tree}, db, nil
+	m.committed = m.Tree
+
+	return m, nil
 }
 
-func (m *Merk) Get(key []byte) []byte {
-	if m.Tree == nil {
-		return nil // empty tree
+// Get returns nil if the key is not found, use GetWithFound to tell it from an empty value
+func (m *Merk) Get(key []byte) ([]byte, error) {
+	value, _, err := m.GetWithFound(key)
+	return value, err
+}
+
+func (m *Merk) GetWithFound(key []byte) ([]byte, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return getWithFound(m.Tree, key)
+}
+
+func getWithFound(tree *Tree, key []byte) ([]byte, bool, error) {
+	if tree == nil {
+		return nil, false, nil // empty tree
 	}
 
-	var cursor *Tree = m.Tree
+	var cursor *Tree = tree
 	for {
 		if bytes.Equal(key, cursor.Key()) {
-			return cursor.Value()
+			return cursor.Value(), true, nil
 		}
 
 		isLeft := bytes.Compare(key, cursor.Key()) == -1
-		maybeChild := cursor.Child(isLeft)
+		maybeChild, err := cursor.Child(isLeft)
+		if err != nil {
+			return nil, false, err
+		}
 		if maybeChild == nil {
 			break // not found
 		}
@@ -54,57 +127,156 @@ func (m *Merk) Get(key []byte) []byte {
 		cursor = maybeChild
 	}
 
-	return nil
+	return nil, false, nil
+}
+
+func (m *Merk) Has(key []byte) (bool, error) {
+	_, found, err := m.GetWithFound(key)
+	return found, err
 }
 
 func (m *Merk) RootHash() Hash {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.rootHash()
+}
+
+func (m *Merk) rootHash() Hash {
 	if m.Tree == nil {
 		return NullHash
 	}
 	return m.Tree.Hash()
 }
 
+// Apply applies the sorted batch to the working tree, returns the deleted keys.
+// Whether each op met its condition is reported by OP.Applied, which Apply sets on the ops
+// of the batch in place. The flags are all false if Apply fails.
+// The changes are pending until Commit, or committed at once if withCommit.
 func (m *Merk) Apply(batch Batch, withCommit bool) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	batch.resetApplied()
+
 	var prevKey []byte
 	for i := 0; i < len(batch); i++ {
+		switch batch[i].O {
+		case Put, Del, PutIfAbsent, CompareAndSwap, DeleteIfExists:
+		case Merge:
+			if _, ok := lookupMergeFunc(batch[i].M); !ok {
+				return nil, fmt.Errorf("%w: %v", ErrUnknownMerge, batch[i].M)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %v", ErrUnknownOP, batch[i].O)
+		}
 		// ensure keys in batch are sorted and unique
 		if bytes.Compare(batch[i].K, prevKey) == -1 {
-			return nil, errors.New("keys in batch must be sorted")
+			return nil, fmt.Errorf("%w: %v", ErrUnsortedBatch, batch[i].K)
 		} else if bytes.Equal(batch[i].K, prevKey) {
-			return nil, fmt.Errorf("keys in batch must be unique, %v", batch[i].K)
+			return nil, fmt.Errorf("%w: %v", ErrDuplicateKey, batch[i].K)
 		}
 		// ensure size of keys and values less than limit
 		if uint32(len(batch[i].K)) > uint32(math.MaxUint32) {
-			return nil, fmt.Errorf("Too long, key: %v ", batch[i].K)
+			return nil, fmt.Errorf("%w: key %v", ErrTooLong, batch[i].K)
 		}
 		if uint32(len(batch[i].V)) > uint32(math.MaxUint32) {
-			return nil, fmt.Errorf("too long, value: %v ", batch[i].V)
+			return nil, fmt.Errorf("%w: value %v", ErrTooLong, batch[i].V)
 		}
 		prevKey = batch[i].K
 	}
 
 	// batch = SortBatch(batch)
-	return m.ApplyUnchecked(batch, withCommit)
+	return m.applyUnchecked(batch, withCommit)
 }
 
-// TODO: separate commiting
+// ApplyUnchecked is Apply without the validation of the batch
 func (m *Merk) ApplyUnchecked(batch Batch, withCommit bool) ([][]byte, error) {
-	var (
-		deletedKeys [][]byte
-		err         error
-	)
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
+	batch.resetApplied()
+
+	return m.applyUnchecked(batch, withCommit)
+}
+
+func (m *Merk) applyUnchecked(batch Batch, withCommit bool) ([][]byte, error) {
 	if batch == nil {
-		return nil, errors.New("empty batch")
+		return nil, ErrEmptyBatch
+	}
+
+	if m.legacy {
+		return nil, ErrLegacyFormat
+	}
+
+	// apply to the copy, so the tree is unchanged on failure
+	tree, deleted, err := applyTo(m.workers, m.Tree.clone(), batch)
+	if err != nil {
+		batch.resetApplied()
+		return nil, err
+	}
+
+	var written [][]byte
+	for _, op := range batch {
+		if op.applied {
+			written = append(written, op.K)
+		}
 	}
 
-	m.Tree, deletedKeys, err = applyTo(m.Tree, batch)
+	deletedKeys, err := m.afterApply(tree, deleted, written, withCommit)
 	if err != nil {
+		batch.resetApplied()
 		return nil, err
 	}
 
+	return deletedKeys, nil
+}
+
+// DeleteRange deletes the keys in [start, end) in a single traversal, nil means unbounded.
+// Returns the deleted keys like ApplyUnchecked.
+func (m *Merk) DeleteRange(start, end []byte, withCommit bool) ([][]byte, error) {
+	if start != nil && end != nil && bytes.Compare(start, end) > 0 {
+		return nil, ErrInvalidRange
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.legacy {
+		return nil, ErrLegacyFormat
+	}
+
+	if m.Tree == nil {
+		return [][]byte{}, nil
+	}
+
+	tree, deleted, err := deleteRange(m.Tree.clone(), start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.afterApply(tree, deleted, nil, withCommit)
+}
+
+// afterApply replaces the tree, records the deleted nodes as orphans and the written keys as pending,
+// and commits. Returns the sorted deleted keys. The tree is restored if the commit fails.
+func (m *Merk) afterApply(tree *Tree, deleted []*Tree, written [][]byte, withCommit bool) ([][]byte, error) {
+	prevTree, prevOrphans, prevPending := m.Tree, m.orphans, m.pending
+
+	m.Tree = tree
+
+	deletedKeys := make([][]byte, len(deleted))
+	for i, t := range deleted {
+		deletedKeys[i] = t.Key()
+		if t.stored != NullHash {
+			m.orphans = append(m.orphans, t.stored)
+		}
+	}
+
 	sortBytes(deletedKeys)
 
+	m.pending = append(append(m.pending, written...), deletedKeys...)
+
 	// Note: don't execute for performance
 	// ensure tree valance
 	// if m.Tree != nil {
@@ -114,69 +286,196 @@ func (m *Merk) ApplyUnchecked(batch Batch, withCommit bool) ([][]byte, error) {
 	// }
 
 	// commit if db exist
-	if gDB != nil && withCommit {
-		m.Commit(deletedKeys)
+	if m.db != nil && withCommit {
+		if err := m.commit(); err != nil {
+			m.Tree, m.orphans, m.pending = prevTree, prevOrphans, prevPending
+			return nil, err
+		}
 	}
 
 	return deletedKeys, nil
 }
 
-func (m *Merk) Commit(deletedKeys [][]byte) error {
-	wb := gDB.newWriteBatch()
-	defer wb.cancel()
+// Commit writes the modified nodes as the next version, and deletes the orphaned nodes
+// and the versions out of the retention
+func (m *Merk) Commit() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.commit()
+}
+
+func (m *Merk) commit() (err error) {
+	if m.db == nil {
+		return ErrDBClosed
+	}
+
+	if m.opts.ReadOnly {
+		return ErrReadOnly
+	}
+
+	wb := m.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	var (
+		orphans []Hash = m.orphans
+		written map[Hash]bool
+	)
 
-	tree := m.Tree
+	// the committed tree is shared with views, so the nodes are written to the copy
+	tree := m.Tree.clone()
+	root := NullHash
 	if tree != nil {
-		committer := newCommitter(wb, tree.height(), DafaultLevels)
+		committer := newCommitter(m.db, wb, tree.height(), m.opts.Levels, m.workers)
+		defer func() {
+			if err != nil {
+				committer.revert()
+			}
+		}()
+
 		if err := tree.commit(committer); err != nil {
 			return err
 		}
 
-		var h Hash = m.RootHash()
-		if err := wb.put(RootKey, h[:]); err != nil {
+		orphans = append(orphans, committer.orphans...)
+		written = committer.written
+
+		root = tree.Hash()
+		if err := wb.Put(RootKey, root[:]); err != nil {
 			return err
 		}
 
 	} else {
 		// empty tree, delete root
-		if err := wb.delete(RootKey); err != nil {
+		if err := wb.Delete(RootKey); err != nil {
 			return err
 		}
 	}
 
-	for _, key := range deletedKeys {
-		if err := wb.delete(key); err != nil {
+	version := m.version + 1
+
+	versions, released, err := m.writeVersion(wb, version, root)
+	if err != nil {
+		return err
+	}
+
+	// the retained versions other than this one and the views pin the previous roots
+	pinned := len(versions) > 1 || len(m.pinnedViews()) > 0
+	if !pinned {
+		if pinned, err = hasSnapshots(m.db); err != nil {
 			return err
 		}
 	}
 
+	if err := writeOrphans(m.db, wb, orphans, written, m.revived, pinned); err != nil {
+		return err
+	}
+
 	// write to db
-	if err := gDB.commitWriteBatch(wb); err != nil {
+	if err := m.db.CommitWriteBatch(wb); err != nil {
 		return err
 	}
 
+	if pinned && len(orphans) > 0 {
+		m.pinOrphans()
+	}
+
+	m.Tree, m.committed = tree, tree
+	m.orphans, m.revived, m.pending = nil, nil, nil
+	m.version, m.versions = version, versions
+
+	// pending orphans may be unpinned by the released versions
+	if released {
+		return collectGarbage(m.db, m.pinnedViews())
+	}
+
 	return nil
 }
 
+// Revert replaces the tree with the snapshot, which is stored on the next commit
 func (m *Merk) Revert(snapshotKey Hash) (err error) {
-	if gDB == nil {
-		err = errors.New("db is not open")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.db == nil {
+		err = ErrDBClosed
+		return
+	}
+
+	tree, err := fetchTrees(m.db, snapshotKey[:], m.opts.Levels)
+	if err != nil {
+		return
+	}
+
+	root, err := storedRoot(m.db)
+	if err != nil {
 		return
 	}
 
-	m.Tree, err = gDB.fetchTrees(snapshotKey[:])
+	orphans, revived, err := diffRoots(m.db, root, snapshotKey)
 	if err != nil {
 		return
 	}
 
+	m.Tree, m.orphans, m.revived, m.pending = tree, orphans, revived, nil
+
 	return
 }
 
-// Take snapshot from current stored tree
-func TakeDBSnapshot() (Hash, error) {
-	if gDB == nil {
-		return NullHash, errors.New("db is not open")
+// Pending returns the sorted keys written by Apply and DeleteRange since the last commit,
+// including the ones written back to the committed value. Revert and LoadVersion throw
+// the pending changes away, and their own changes are not included, see Dirty.
+func (m *Merk) Pending() [][]byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([][]byte, len(m.pending))
+	copy(keys, m.pending)
+
+	sortBytes(keys)
+
+	// remove duplicates
+	unique := keys[:0]
+	for _, key := range keys {
+		if len(unique) == 0 || !bytes.Equal(key, unique[len(unique)-1]) {
+			unique = append(unique, key)
+		}
+	}
+
+	return unique
+}
+
+// Dirty reports whether the tree differs from the last commit, including the changes
+// of Revert and LoadVersion which are not reported by Pending
+func (m *Merk) Dirty() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	committed := NullHash
+	if m.committed != nil {
+		committed = m.committed.Hash()
 	}
 
-	return gDB.takeSnapshot()
+	var version uint64
+	if len(m.versions) > 0 {
+		version = m.versions[len(m.versions)-1]
+	}
+
+	return m.rootHash() != committed || m.version != version
+}
+
+// Discard throws away the uncommitted changes including Revert and LoadVersion,
+// and restores the last committed tree without reading db
+func (m *Merk) Discard() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Tree = m.committed
+	m.orphans, m.revived, m.pending = nil, nil, nil
+
+	// LoadVersion moves the version until commit
+	m.version = 0
+	if len(m.versions) > 0 {
+		m.version = m.versions[len(m.versions)-1]
+	}
 }
@@ -2,6 +2,7 @@ package merk
 
 import (
 	"bytes"
+	"errors"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/blake2b"
 	"math"
@@ -17,16 +18,16 @@ func TestApply(t *testing.T) {
 	m := &Merk{}
 
 	/** Insert & Update Case **/
-	op0 := &OP{Put, []byte("0"), []byte("value")}
-	op1 := &OP{Put, []byte("1"), []byte("value")}
-	op2 := &OP{Put, []byte("2"), []byte("value")}
-	op3 := &OP{Put, []byte("3"), []byte("value")}
-	op4 := &OP{Put, []byte("4"), []byte("value")}
-	op5 := &OP{Put, []byte("5"), []byte("value")}
-	op6 := &OP{Put, []byte("6"), []byte("value")}
-	op7 := &OP{Put, []byte("7"), []byte("value")}
-	op8 := &OP{Put, []byte("8"), []byte("value")}
-	op9 := &OP{Put, []byte("9"), []byte("value")}
+	op0 := &OP{O: Put, K: []byte("0"), V: []byte("value")}
+	op1 := &OP{O: Put, K: []byte("1"), V: []byte("value")}
+	op2 := &OP{O: Put, K: []byte("2"), V: []byte("value")}
+	op3 := &OP{O: Put, K: []byte("3"), V: []byte("value")}
+	op4 := &OP{O: Put, K: []byte("4"), V: []byte("value")}
+	op5 := &OP{O: Put, K: []byte("5"), V: []byte("value")}
+	op6 := &OP{O: Put, K: []byte("6"), V: []byte("value")}
+	op7 := &OP{O: Put, K: []byte("7"), V: []byte("value")}
+	op8 := &OP{O: Put, K: []byte("8"), V: []byte("value")}
+	op9 := &OP{O: Put, K: []byte("9"), V: []byte("value")}
 
 	batch1 = append(batch1, op3, op6, op8)
 	m.Apply(batch1, false)
@@ -75,30 +76,57 @@ func TestGet(t *testing.T) {
 
 	m := &Merk{}
 
-	op0 := &OP{Put, []byte("key0"), []byte("value0")}
-	op1 := &OP{Put, []byte("key1"), []byte("value1")}
-	op2 := &OP{Put, []byte("key2"), []byte("value2")}
-	op3 := &OP{Put, []byte("key3"), []byte("value3")}
-	op4 := &OP{Put, []byte("key4"), []byte("value4")}
-	op5 := &OP{Put, []byte("key5"), []byte("value5")}
-	op6 := &OP{Put, []byte("key6"), []byte("value6")}
-	op7 := &OP{Put, []byte("key7"), []byte("value7")}
-	op8 := &OP{Put, []byte("key8"), []byte("value8")}
-	op9 := &OP{Put, []byte("key9"), []byte("value9")}
+	op0 := &OP{O: Put, K: []byte("key0"), V: []byte("value0")}
+	op1 := &OP{O: Put, K: []byte("key1"), V: []byte("value1")}
+	op2 := &OP{O: Put, K: []byte("key2"), V: []byte("value2")}
+	op3 := &OP{O: Put, K: []byte("key3"), V: []byte("value3")}
+	op4 := &OP{O: Put, K: []byte("key4"), V: []byte("value4")}
+	op5 := &OP{O: Put, K: []byte("key5"), V: []byte("value5")}
+	op6 := &OP{O: Put, K: []byte("key6"), V: []byte("value6")}
+	op7 := &OP{O: Put, K: []byte("key7"), V: []byte("value7")}
+	op8 := &OP{O: Put, K: []byte("key8"), V: []byte("value8")}
+	op9 := &OP{O: Put, K: []byte("key9"), V: []byte("value9")}
 
 	batch = append(batch, op0, op1, op2, op3, op4, op5, op6, op7, op8, op9)
 	m.Apply(batch, false)
 
-	require.EqualValues(t, []byte("value0"), m.Get([]byte("key0")))
-	require.EqualValues(t, []byte("value1"), m.Get([]byte("key1")))
-	require.EqualValues(t, []byte("value2"), m.Get([]byte("key2")))
-	require.EqualValues(t, []byte("value3"), m.Get([]byte("key3")))
-	require.EqualValues(t, []byte("value4"), m.Get([]byte("key4")))
-	require.EqualValues(t, []byte("value5"), m.Get([]byte("key5")))
-	require.EqualValues(t, []byte("value6"), m.Get([]byte("key6")))
-	require.EqualValues(t, []byte("value7"), m.Get([]byte("key7")))
-	require.EqualValues(t, []byte("value8"), m.Get([]byte("key8")))
-	require.EqualValues(t, []byte("value9"), m.Get([]byte("key9")))
+	require.EqualValues(t, []byte("value0"), mustGet(t, m, []byte("key0")))
+	require.EqualValues(t, []byte("value1"), mustGet(t, m, []byte("key1")))
+	require.EqualValues(t, []byte("value2"), mustGet(t, m, []byte("key2")))
+	require.EqualValues(t, []byte("value3"), mustGet(t, m, []byte("key3")))
+	require.EqualValues(t, []byte("value4"), mustGet(t, m, []byte("key4")))
+	require.EqualValues(t, []byte("value5"), mustGet(t, m, []byte("key5")))
+	require.EqualValues(t, []byte("value6"), mustGet(t, m, []byte("key6")))
+	require.EqualValues(t, []byte("value7"), mustGet(t, m, []byte("key7")))
+	require.EqualValues(t, []byte("value8"), mustGet(t, m, []byte("key8")))
+	require.EqualValues(t, []byte("value9"), mustGet(t, m, []byte("key9")))
+}
+
+func TestGetWithFound(t *testing.T) {
+	m := &Merk{}
+
+	var batch Batch = []*OP{
+		&OP{O: Put, K: []byte("key0"), V: []byte{}},
+		&OP{O: Put, K: []byte("key1"), V: []byte("value1")},
+	}
+	m.Apply(batch, false)
+
+	value, found, err := m.GetWithFound([]byte("key0"))
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Empty(t, value)
+
+	value, found, _ = m.GetWithFound([]byte("key1"))
+	require.True(t, found)
+	require.EqualValues(t, []byte("value1"), value)
+
+	value, found, _ = m.GetWithFound([]byte("key2"))
+	require.False(t, found)
+	require.Nil(t, value)
+
+	require.True(t, mustHas(t, m, []byte("key0")))
+	require.False(t, mustHas(t, m, []byte("key2")))
+	require.False(t, mustHas(t, &Merk{}, []byte("key0")))
 }
 
 func TestCommit(t *testing.T) {
@@ -108,10 +136,10 @@ func TestCommit(t *testing.T) {
 	defer db.Destroy()
 
 	require.NoError(t, m.Tree.verify())
-	require.EqualValues(t, PrunedLink, m.Tree.Child(true).Link(true).linkType())
-	require.EqualValues(t, PrunedLink, m.Tree.Child(true).Link(false).linkType())
-	require.EqualValues(t, PrunedLink, m.Tree.Child(false).Link(true).linkType())
-	require.EqualValues(t, PrunedLink, m.Tree.Child(false).Link(false).linkType())
+	require.EqualValues(t, PrunedLink, m.Tree.mustChild(true).Link(true).linkType())
+	require.EqualValues(t, PrunedLink, m.Tree.mustChild(true).Link(false).linkType())
+	require.EqualValues(t, PrunedLink, m.Tree.mustChild(false).Link(true).linkType())
+	require.EqualValues(t, PrunedLink, m.Tree.mustChild(false).Link(false).linkType())
 }
 
 func TestCommitFetchTree(t *testing.T) {
@@ -124,11 +152,64 @@ func TestCommitFetchTree(t *testing.T) {
 
 	db.Close()
 
-	m, db, _ = New(testDBDir)
+	db, _ = NewBadger(testDBDir, DefaultOptions())
+	m, _ = New(db, DefaultOptions())
+	defer db.Close()
+	defer db.Destroy()
+
+	require.NoError(t, m.Tree.verify())
+}
+
+func TestLazyLoad(t *testing.T) {
+	var m *Merk
+
+	m, db := buildMerkWithDB()
 	defer db.Close()
 	defer db.Destroy()
 
+	hash := m.RootHash()
+
+	opts := DefaultOptions()
+	opts.Levels = 0
+
+	m, err := New(db, opts)
+	require.NoError(t, err)
+	require.EqualValues(t, hash, m.RootHash())
+	require.EqualValues(t, PrunedLink, m.Tree.Link(true).linkType())
+	require.EqualValues(t, PrunedLink, m.Tree.Link(false).linkType())
+
+	for i := 0; i < 10; i++ {
+		key := "key" + strconv.Itoa(i)
+		require.EqualValues(t, []byte("value"+strconv.Itoa(i)), mustGet(t, m, []byte(key)))
+	}
+
+	var batch Batch = []*OP{
+		&OP{O: Del, K: []byte("key1")},
+		&OP{O: Put, K: []byte("key5"), V: []byte("value55")},
+	}
+	_, err = m.Apply(batch, true)
+	require.NoError(t, err)
+	require.Nil(t, mustGet(t, m, []byte("key1")))
+	require.EqualValues(t, []byte("value55"), mustGet(t, m, []byte("key5")))
+}
+
+func TestCommitMemDB(t *testing.T) {
+	var batch Batch
+
+	db := NewMemDB()
+
+	m, err := New(db, DefaultOptions())
+	require.NoError(t, err)
+
+	batch = append(batch, &OP{O: Put, K: []byte("key0"), V: []byte("value0")}, &OP{O: Put, K: []byte("key1"), V: []byte("value1")})
+	_, err = m.Apply(batch, true)
+	require.NoError(t, err)
+
+	m, err = New(db, DefaultOptions())
+	require.NoError(t, err)
 	require.NoError(t, m.Tree.verify())
+	require.EqualValues(t, []byte("value0"), mustGet(t, m, []byte("key0")))
+	require.EqualValues(t, []byte("value1"), mustGet(t, m, []byte("key1")))
 }
 
 func TestCommitDel(t *testing.T) {
@@ -149,20 +230,49 @@ func TestCommitDel(t *testing.T) {
 	require.NoError(t, m.Tree.verify())
 }
 
+func TestMultipleMerk(t *testing.T) {
+	m1, db1 := buildMerkWithDB()
+	defer db1.Close()
+	defer db1.Destroy()
+
+	db2, err := NewBadger(testDBDir+"2", DefaultOptions())
+	require.NoError(t, err)
+	defer db2.Close()
+	defer db2.Destroy()
+
+	m2, err := New(db2, DefaultOptions())
+	require.NoError(t, err)
+
+	var batch Batch = []*OP{
+		&OP{O: Put, K: []byte("key0"), V: []byte("value00")},
+		&OP{O: Put, K: []byte("key10"), V: []byte("value10")},
+	}
+	_, err = m2.Apply(batch, true)
+	require.NoError(t, err)
+
+	require.EqualValues(t, []byte("value0"), mustGet(t, m1, []byte("key0")))
+	require.EqualValues(t, []byte("value9"), mustGet(t, m1, []byte("key9")))
+	require.Nil(t, mustGet(t, m1, []byte("key10")))
+	require.EqualValues(t, []byte("value00"), mustGet(t, m2, []byte("key0")))
+	require.EqualValues(t, []byte("value10"), mustGet(t, m2, []byte("key10")))
+	require.Nil(t, mustGet(t, m2, []byte("key9")))
+	require.NotEqual(t, m1.RootHash(), m2.RootHash())
+}
+
 func TestTakeSnapshot(t *testing.T) {
 	m, db := buildMerkWithDB()
 	defer db.Close()
 	defer db.Destroy()
 
-	snapshotKey, err := TakeDBSnapshot()
+	snapshotKey, err := m.TakeDBSnapshot()
 	require.NoError(t, err)
 	require.EqualValues(t, m.RootHash(), snapshotKey)
 
 	var batch Batch = []*OP{
 		&OP{O: Del, K: []byte("key1")},
-		&OP{Put, []byte("key5"), []byte("value55")},
+		&OP{O: Put, K: []byte("key5"), V: []byte("value55")},
 		&OP{O: Del, K: []byte("key8")},
-		&OP{Put, []byte("key10"), []byte("value10")},
+		&OP{O: Put, K: []byte("key10"), V: []byte("value10")},
 	}
 	m.Apply(batch, true)
 
@@ -172,32 +282,293 @@ func TestTakeSnapshot(t *testing.T) {
 	require.NoError(t, m.Tree.verify())
 	require.EqualValues(t, m.Tree.Key(), []byte("key5"))
 	require.EqualValues(t, m.Tree.Value(), []byte("value5"))
-	require.EqualValues(t, m.Tree.Link(true).key(), []byte("key2"))
-	require.EqualValues(t, m.Tree.Link(true).tree().Link(true).key(), []byte("key1"))
-	require.EqualValues(t, m.Tree.Link(true).tree().Link(true).tree().Link(true).key(), []byte("key0"))
-	require.EqualValues(t, m.Tree.Link(true).tree().Link(false).key(), []byte("key4"))
-	require.EqualValues(t, m.Tree.Link(true).tree().Link(false).tree().Link(true).key(), []byte("key3"))
-	require.EqualValues(t, m.Tree.Link(false).key(), []byte("key8"))
-	require.EqualValues(t, m.Tree.Link(false).tree().Link(true).key(), []byte("key7"))
-	require.EqualValues(t, m.Tree.Link(false).tree().Link(true).tree().Link(true).key(), []byte("key6"))
-	require.EqualValues(t, m.Tree.Link(false).tree().Link(false).key(), []byte("key9"))
+	require.EqualValues(t, m.Tree.mustChild(true).Key(), []byte("key2"))
+	require.EqualValues(t, m.Tree.mustChild(true).mustChild(true).Key(), []byte("key1"))
+	require.EqualValues(t, m.Tree.mustChild(true).mustChild(true).mustChild(true).Key(), []byte("key0"))
+	require.EqualValues(t, m.Tree.mustChild(true).mustChild(false).Key(), []byte("key4"))
+	require.EqualValues(t, m.Tree.mustChild(true).mustChild(false).mustChild(true).Key(), []byte("key3"))
+	require.EqualValues(t, m.Tree.mustChild(false).Key(), []byte("key8"))
+	require.EqualValues(t, m.Tree.mustChild(false).mustChild(true).Key(), []byte("key7"))
+	require.EqualValues(t, m.Tree.mustChild(false).mustChild(true).mustChild(true).Key(), []byte("key6"))
+	require.EqualValues(t, m.Tree.mustChild(false).mustChild(false).Key(), []byte("key9"))
+}
+
+func TestApplyErrors(t *testing.T) {
+	m, err := New(NewMemDB(), DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.Apply(Batch{&OP{O: Put, K: []byte("b")}, &OP{O: Put, K: []byte("a")}}, true)
+	require.True(t, errors.Is(err, ErrUnsortedBatch))
+
+	_, err = m.Apply(Batch{&OP{O: Put, K: []byte("a")}, &OP{O: Put, K: []byte("a")}}, true)
+	require.True(t, errors.Is(err, ErrDuplicateKey))
+
+	_, err = m.Apply(Batch{&OP{O: Del, K: []byte("a")}}, true)
+	require.True(t, errors.Is(err, ErrDeleteMissing))
+
+	_, err = m.ApplyUnchecked(nil, true)
+	require.True(t, errors.Is(err, ErrEmptyBatch))
+
+	require.True(t, errors.Is(m.LoadVersion(1), ErrVersionNotFound))
+	require.True(t, errors.Is(m.ReleaseSnapshot(Hash{1}), ErrSnapshotNotFound))
+
+	_, err = New(nil, DefaultOptions())
+	require.True(t, errors.Is(err, ErrDBClosed))
+
+	opts := DefaultOptions()
+	opts.MaxWorkers = -1
+	_, err = New(NewMemDB(), opts)
+	require.True(t, errors.Is(err, ErrInvalidOptions))
+
+	opts.MaxWorkers, opts.ReadOnly = 0, true
+	m, err = New(NewMemDB(), opts)
+	require.NoError(t, err)
+	require.True(t, errors.Is(m.Commit(), ErrReadOnly))
+}
+
+var errFault = errors.New("fault")
+
+// faultyDB fails to read nodes or to commit while the flags are set
+type faultyDB struct {
+	DB
+	failGet, failCommit bool
+}
+
+func (d *faultyDB) Get(key []byte) ([]byte, error) {
+	if d.failGet && bytes.HasPrefix(key, NodeKeyPrefix) {
+		return nil, errFault
+	}
+	return d.DB.Get(key)
+}
+
+func (d *faultyDB) CommitWriteBatch(wb WriteBatch) error {
+	if d.failCommit {
+		return errFault
+	}
+	return d.DB.CommitWriteBatch(wb)
+}
+
+// getter is either Merk or View
+type getter interface {
+	GetWithFound(key []byte) ([]byte, bool, error)
+}
+
+func mustGet(t *testing.T, g getter, key []byte) []byte {
+	value, _, err := g.GetWithFound(key)
+	require.NoError(t, err)
+	return value
+}
+
+func mustHas(t *testing.T, g getter, key []byte) bool {
+	_, found, err := g.GetWithFound(key)
+	require.NoError(t, err)
+	return found
+}
+
+func TestStorageErrors(t *testing.T) {
+	db := &faultyDB{DB: NewMemDB()}
+	opts := DefaultOptions()
+	opts.Levels = 0
+
+	m, err := New(db, opts)
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value"), true)
+	require.NoError(t, err)
+
+	root := m.RootHash()
+
+	// fetch failure
+	db.failGet = true
+
+	_, err = m.Get([]byte("key1003"))
+	require.True(t, errors.Is(err, errFault))
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value2"), false)
+	require.True(t, errors.Is(err, errFault))
+	require.EqualValues(t, root, m.RootHash())
+
+	_, err = m.DeleteRange([]byte("key1010"), []byte("key1090"), false)
+	require.True(t, errors.Is(err, errFault))
+	require.EqualValues(t, root, m.RootHash())
+
+	it := m.Iterator(nil, nil)
+	for it.Next() {
+	}
+	require.True(t, errors.Is(it.Err(), errFault))
+
+	db.failGet = false
+
+	require.EqualValues(t, []byte("value"), mustGet(t, m, []byte("key1050")))
+
+	// commit failure
+	db.failCommit = true
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value2"), true)
+	require.True(t, errors.Is(err, errFault))
+	require.EqualValues(t, root, m.RootHash())
+	require.EqualValues(t, []byte("value"), mustGet(t, m, []byte("key1050")))
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value2"), false)
+	require.NoError(t, err)
+	require.True(t, errors.Is(m.Commit(), errFault))
+
+	// the failed commit is retried
+	db.failCommit = false
+
+	require.NoError(t, m.Commit())
+
+	expected, err := New(NewMemDB(), opts)
+	require.NoError(t, err)
+	_, err = expected.Apply(buildSeqBatch(0, 100, Put, "value"), true)
+	require.NoError(t, err)
+	_, err = expected.Apply(buildSeqBatch(0, 100, Put, "value2"), true)
+	require.NoError(t, err)
+
+	require.EqualValues(t, expected.RootHash(), m.RootHash())
+	require.EqualValues(t, storedNodes(t, expected.db), storedNodes(t, db))
+
+	reloaded, err := New(db, opts)
+	require.NoError(t, err)
+	require.EqualValues(t, []byte("value2"), mustGet(t, reloaded, []byte("key1050")))
+}
+
+func TestApplyFailureUnchanged(t *testing.T) {
+	m, err := New(NewMemDB(), DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 10, Put, "value"), false)
+	require.NoError(t, err)
+
+	root := m.RootHash()
+
+	// the merge fails after the other ops are applied
+	var batch Batch = []*OP{
+		&OP{O: Put, K: []byte("key1000"), V: []byte("value2")},
+		&OP{O: Del, K: []byte("key1001")},
+		&OP{O: Merge, K: []byte("key1005"), V: []byte{1}, M: MergeUint64Add},
+		&OP{O: Put, K: []byte("key1010"), V: []byte("value2")},
+	}
+	_, err = m.Apply(batch, true)
+	require.Error(t, err)
+
+	require.EqualValues(t, root, m.RootHash())
+	require.NoError(t, m.Tree.verify())
+	require.EqualValues(t, []byte("value"), mustGet(t, m, []byte("key1000")))
+	require.True(t, mustHas(t, m, []byte("key1001")))
+	require.False(t, mustHas(t, m, []byte("key1010")))
+}
+
+func TestPendingDiscard(t *testing.T) {
+	db := &faultyDB{DB: NewMemDB()}
+	opts := DefaultOptions()
+	opts.KeepRecent = 0
+
+	m, err := New(db, opts)
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 10, Put, "value"), true)
+	require.NoError(t, err)
+	require.Empty(t, m.Pending())
+	require.False(t, m.Dirty())
+
+	root := m.RootHash()
+
+	var batch Batch = []*OP{
+		&OP{O: Put, K: []byte("key1000"), V: []byte("value2")},
+		&OP{O: Del, K: []byte("key1001")},
+		&OP{O: PutIfAbsent, K: []byte("key1002"), V: []byte("value2")},
+		&OP{O: Put, K: []byte("key1020"), V: []byte("value2")},
+	}
+	_, err = m.Apply(batch, false)
+	require.NoError(t, err)
+	_, err = m.DeleteRange([]byte("key1005"), []byte("key1007"), false)
+	require.NoError(t, err)
+	_, err = m.Apply([]*OP{&OP{O: Put, K: []byte("key1000"), V: []byte("value3")}}, false)
+	require.NoError(t, err)
+
+	expected := [][]byte{[]byte("key1000"), []byte("key1001"), []byte("key1005"), []byte("key1006"), []byte("key1020")}
+	require.EqualValues(t, expected, m.Pending())
+	require.EqualValues(t, []byte("value3"), mustGet(t, m, []byte("key1000")))
+	require.NotEqual(t, root, m.RootHash())
+	require.True(t, m.Dirty())
+
+	// restored without reading db
+	db.failGet = true
+	m.Discard()
+	db.failGet = false
+
+	require.EqualValues(t, root, m.RootHash())
+	require.Empty(t, m.Pending())
+	require.False(t, m.Dirty())
+	require.EqualValues(t, []byte("value"), mustGet(t, m, []byte("key1000")))
+	require.True(t, mustHas(t, m, []byte("key1001")))
+	require.False(t, mustHas(t, m, []byte("key1020")))
+
+	// the discarded orphans are not deleted by the next commit
+	_, err = m.Apply(buildSeqBatch(0, 3, Put, "value2"), true)
+	require.NoError(t, err)
+	require.EqualValues(t, uint64(2), m.Version())
+	require.Empty(t, m.Pending())
+
+	require.NoError(t, m.LoadVersion(1))
+	require.EqualValues(t, root, m.RootHash())
+	require.EqualValues(t, uint64(1), m.Version())
+	require.True(t, m.Dirty())
+
+	m.Discard()
+	require.False(t, m.Dirty())
+	require.EqualValues(t, uint64(2), m.Version())
+	require.EqualValues(t, []byte("value2"), mustGet(t, m, []byte("key1000")))
+
+	// the changes thrown away by LoadVersion and Revert are not pending
+	_, err = m.Apply(buildSeqBatch(0, 1, Put, "value3"), false)
+	require.NoError(t, err)
+	require.NoError(t, m.LoadVersion(1))
+	require.Empty(t, m.Pending())
+	require.True(t, m.Dirty())
+	m.Discard()
+
+	snapshotKey, err := m.TakeDBSnapshot()
+	require.NoError(t, err)
+	_, err = m.Apply(buildSeqBatch(0, 1, Put, "value3"), false)
+	require.NoError(t, err)
+	require.NoError(t, m.Revert(snapshotKey))
+	require.Empty(t, m.Pending())
+	require.False(t, m.Dirty()) // back to the committed root
+	m.Discard()
+
+	_, err = m.Apply(buildSeqBatch(0, 1, Put, "value3"), true)
+	require.NoError(t, err)
+	require.NoError(t, m.Revert(snapshotKey))
+	require.Empty(t, m.Pending())
+	require.True(t, m.Dirty())
+	m.Discard()
+	require.NoError(t, m.ReleaseSnapshot(snapshotKey))
+
+	opts.KeepRecent = 1
+	m, err = New(db, opts)
+	require.NoError(t, err)
+	require.NoError(t, m.Commit())
+	require.EqualValues(t, reachableNodes(t, db, m.RootHash()), storedNodes(t, db))
 }
 
 func buildMerkWithDB() (*Merk, DB) {
 	var batch Batch
 
-	m, db, _ := New(testDBDir)
+	db, _ := NewBadger(testDBDir, DefaultOptions())
+	m, _ := New(db, DefaultOptions())
 
-	op0 := &OP{Put, []byte("key0"), []byte("value0")}
-	op1 := &OP{Put, []byte("key1"), []byte("value1")}
-	op2 := &OP{Put, []byte("key2"), []byte("value2")}
-	op3 := &OP{Put, []byte("key3"), []byte("value3")}
-	op4 := &OP{Put, []byte("key4"), []byte("value4")}
-	op5 := &OP{Put, []byte("key5"), []byte("value5")}
-	op6 := &OP{Put, []byte("key6"), []byte("value6")}
-	op7 := &OP{Put, []byte("key7"), []byte("value7")}
-	op8 := &OP{Put, []byte("key8"), []byte("value8")}
-	op9 := &OP{Put, []byte("key9"), []byte("value9")}
+	op0 := &OP{O: Put, K: []byte("key0"), V: []byte("value0")}
+	op1 := &OP{O: Put, K: []byte("key1"), V: []byte("value1")}
+	op2 := &OP{O: Put, K: []byte("key2"), V: []byte("value2")}
+	op3 := &OP{O: Put, K: []byte("key3"), V: []byte("value3")}
+	op4 := &OP{O: Put, K: []byte("key4"), V: []byte("value4")}
+	op5 := &OP{O: Put, K: []byte("key5"), V: []byte("value5")}
+	op6 := &OP{O: Put, K: []byte("key6"), V: []byte("value6")}
+	op7 := &OP{O: Put, K: []byte("key7"), V: []byte("value7")}
+	op8 := &OP{O: Put, K: []byte("key8"), V: []byte("value8")}
+	op9 := &OP{O: Put, K: []byte("key9"), V: []byte("value9")}
 
 	batch = append(batch, op0, op1, op2, op3, op4, op5, op6, op7, op8, op9)
 	m.Apply(batch, true)
@@ -211,7 +582,7 @@ func BenchmarkApply(b *testing.B) {
 		size  int = 100_000
 	)
 
-	m := &Merk{}
+	m := &Merk{workers: newWorkers(DefaultOptions())}
 
 	b.ReportAllocs()
 	b.ResetTimer()
@@ -234,7 +605,8 @@ func BenchmarkCommit(b *testing.B) {
 		size  int = 100_000
 	)
 
-	m, db, _ := New(testDBDir)
+	db, _ := NewBadger(testDBDir, DefaultOptions())
+	m, _ := New(db, DefaultOptions())
 
 	defer db.Close()
 	defer db.Destroy()
@@ -254,6 +626,73 @@ func BenchmarkCommit(b *testing.B) {
 	}
 }
 
+// parallelism compares sequential, spawning at every level as before the budget, and the defaults
+func parallelism() ([]string, []Options) {
+	sequential := DefaultOptions()
+	sequential.MaxWorkers = 0
+
+	eager := DefaultOptions()
+	eager.MaxWorkers = math.MaxInt32
+	eager.MinParallelBatch = 0
+	eager.MinParallelHeight = 0
+
+	return []string{"sequential", "eager", "default"}, []Options{sequential, eager, DefaultOptions()}
+}
+
+func BenchmarkApplyParallelism(b *testing.B) {
+	names, options := parallelism()
+	for i, opts := range options {
+		b.Run(names[i], func(b *testing.B) {
+			var batch Batch
+
+			m := &Merk{workers: newWorkers(opts)}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for n := 0; n < b.N; n++ {
+				b.StopTimer()
+				batch = buildBatch(batch, 100_000)
+				b.StartTimer()
+
+				if _, err := m.ApplyUnchecked(batch, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCommitParallelism(b *testing.B) {
+	names, options := parallelism()
+	for i, opts := range options {
+		b.Run(names[i], func(b *testing.B) {
+			var batch Batch
+
+			m, err := New(NewMemDB(), opts)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for n := 0; n < b.N; n++ {
+				b.StopTimer()
+				batch = buildBatch(batch, 100_000)
+				if _, err := m.ApplyUnchecked(batch, false); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				if err := m.Commit(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func buildBatch(b Batch, size int) Batch {
 	var batch Batch
 
@@ -262,7 +701,7 @@ func buildBatch(b Batch, size int) Batch {
 		for i := 0; i < size; i++ {
 			key := blake2b.Sum256([]byte("key" + strconv.Itoa(i) + strconv.Itoa(RandIntn(math.MaxUint32))))
 			val := bytes.Repeat([]byte("x"), RandIntn(1000))
-			op := &OP{Put, key[:], val}
+			op := &OP{O: Put, K: key[:], V: val}
 			batch = append(batch, op)
 		}
 
@@ -273,7 +712,7 @@ func buildBatch(b Batch, size int) Batch {
 	for i := 0; i < size/2; i++ {
 		key1 := blake2b.Sum256([]byte("key" + strconv.Itoa(i) + strconv.Itoa(RandIntn(math.MaxUint32))))
 		val1 := bytes.Repeat([]byte("x"), RandIntn(1000))
-		op1 := &OP{Put, key1[:], val1}
+		op1 := &OP{O: Put, K: key1[:], V: val1}
 
 		if i%20 == 0 && b[i*2].O == Put {
 			key2 := b[i*2].K
@@ -285,7 +724,7 @@ func buildBatch(b Batch, size int) Batch {
 
 		key2 := b[i*2].K
 		val2 := bytes.Repeat([]byte("x"), RandIntn(1000))
-		op2 := &OP{Put, key2[:], val2}
+		op2 := &OP{O: Put, K: key2[:], V: val2}
 		batch = append(batch, op2, op1)
 	}
 
@@ -0,0 +1,117 @@
+package merk
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Migrate rewrites nodes stored in the legacy format, which lacks child heights,
+// into the current format. The nodes reachable from the stored root and
+// the given roots (e.g. snapshot keys) are migrated.
+// Node hashes don't change, so the roots stay valid. New migrates the stored and pinned roots,
+// unless read only, which refuses to apply to the legacy tree.
+func Migrate(db DB, roots ...Hash) error {
+	topKey, err := db.Get(RootKey)
+	if err == nil {
+		var h Hash
+		copy(h[:], topKey)
+		roots = append(roots, h)
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	migrated := make(map[Hash]bool)
+	for _, root := range roots {
+		if migrated[root] {
+			continue
+		}
+		migrated[root] = true
+
+		if _, err := migrateNode(db, wb, root); err != nil {
+			return fmt.Errorf("failed to migrate root %v: %w", root, err)
+		}
+	}
+
+	return db.CommitWriteBatch(wb)
+}
+
+// migrateNode rewrites the node and its legacy descendants, returns the child heights of the node
+func migrateNode(db DB, wb WriteBatch, hash Hash) ([2]uint8, error) {
+	key := append(NodeKeyPrefix, hash[:]...)
+
+	value, err := db.Get(key)
+	if err != nil {
+		return [2]uint8{}, fmt.Errorf("failed get, %w", err)
+	}
+
+	tree, err := unmarshalTree(value)
+	if err != nil {
+		return [2]uint8{}, err
+	}
+
+	// descendants of a node in current format are also in current format
+	if value[0] == nodeFormatVersion {
+		return tree.ChildHeights(), nil
+	}
+
+	handler := func(isLeft bool) error {
+		l := tree.Link(isLeft)
+		if l == nil {
+			return nil
+		}
+
+		ch, err := migrateNode(db, wb, l.Hash())
+		if err != nil {
+			return err
+		}
+
+		tree.setLink(isLeft, &Pruned{ch: ch, h: l.Hash()})
+		return nil
+	}
+
+	if err := handler(true); err != nil {
+		return [2]uint8{}, err
+	}
+	if err := handler(false); err != nil {
+		return [2]uint8{}, err
+	}
+
+	if err := wb.Put(key, tree.marshal(nil)); err != nil {
+		return [2]uint8{}, err
+	}
+
+	return tree.ChildHeights(), nil
+}
+
+// legacyRoots returns the stored root and the pinned roots which are in the legacy format.
+// The descendants of a node in current format are also in current format, so the roots tell.
+func legacyRoots(db DB) ([]Hash, error) {
+	roots, err := pinnedRoots(db)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := storedRoot(db)
+	if err != nil {
+		return nil, err
+	}
+	if root != NullHash {
+		roots = append(roots, root)
+	}
+
+	var legacy []Hash
+	for _, h := range roots {
+		value, err := db.Get(append(NodeKeyPrefix, h[:]...))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get root %v: %w", h, err)
+		}
+		if len(value) > 0 && value[0] != nodeFormatVersion {
+			legacy = append(legacy, h)
+		}
+	}
+
+	return legacy, nil
+}
@@ -0,0 +1,114 @@
+package merk
+
+import (
+	"errors"
+	"github.com/lithdew/bytesutil"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	var batch Batch
+
+	db := NewMemDB()
+
+	m, err := New(db, DefaultOptions())
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		batch = append(batch, &OP{O: Put, K: []byte{byte(i)}, V: []byte("value")})
+	}
+	_, err = m.Apply(batch, true)
+	require.NoError(t, err)
+
+	hash := m.RootHash()
+	heights := m.Tree.ChildHeights()
+
+	// rewrite all nodes in legacy format
+	err = db.Iterate(NodeKeyPrefix, func(key, value []byte) error {
+		tree, err := unmarshalTree(value)
+		if err != nil {
+			return err
+		}
+		return db.Put(key, marshalLegacy(tree))
+	})
+	require.NoError(t, err)
+
+	// the read only merk reads the legacy tree, but doesn't apply to it
+	opts := DefaultOptions()
+	opts.ReadOnly = true
+
+	m, err = New(db, opts)
+	require.NoError(t, err)
+	require.EqualValues(t, [2]uint8{2, 2}, m.Tree.ChildHeights())
+	require.EqualValues(t, []byte("value"), mustGet(t, m, []byte{99}))
+
+	_, err = m.Apply(Batch{&OP{O: Del, K: []byte{0}}}, false)
+	require.True(t, errors.Is(err, ErrLegacyFormat))
+	_, err = m.DeleteRange(nil, nil, false)
+	require.True(t, errors.Is(err, ErrLegacyFormat))
+
+	// otherwise migrated by New
+	m, err = New(db, DefaultOptions())
+	require.NoError(t, err)
+	require.EqualValues(t, hash, m.RootHash())
+	require.EqualValues(t, heights, m.Tree.ChildHeights())
+	require.EqualValues(t, []byte("value"), mustGet(t, m, []byte{99}))
+
+	require.NoError(t, Migrate(db))
+
+	batch = nil
+	for i := 0; i < 50; i++ {
+		batch = append(batch, &OP{O: Del, K: []byte{byte(i)}})
+	}
+	_, err = m.Apply(batch, true)
+	require.NoError(t, err)
+
+	report, err := m.Check()
+	require.NoError(t, err)
+	require.True(t, report.OK(), report.String())
+}
+
+func TestReloadHeights(t *testing.T) {
+	var batch Batch
+
+	db := NewMemDB()
+
+	opts := DefaultOptions()
+	opts.Levels = 0
+
+	m, err := New(db, opts)
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		batch = append(batch, &OP{O: Put, K: []byte{byte(i)}, V: []byte("value")})
+	}
+	_, err = m.Apply(batch, true)
+	require.NoError(t, err)
+
+	heights := m.Tree.ChildHeights()
+
+	m, err = New(db, opts)
+	require.NoError(t, err)
+	require.EqualValues(t, heights, m.Tree.ChildHeights())
+	require.EqualValues(t, heights, [2]uint8{m.Tree.mustChild(true).height(), m.Tree.mustChild(false).height()})
+}
+
+func marshalLegacy(t *Tree) []byte {
+	var dst []byte
+
+	dst = bytesutil.AppendUint32BE(dst, uint32(len(t.Key())))
+	dst = append(dst, t.Key()...)
+
+	for _, l := range []Link{t.Link(true), t.Link(false)} {
+		if l == nil {
+			dst = append(dst, uint8(0))
+			continue
+		}
+		hash := l.Hash()
+		dst = append(dst, uint8(1))
+		dst = append(dst, hash[:]...)
+	}
+
+	return append(dst, t.Value()...)
+}
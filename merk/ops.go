@@ -1,6 +1,7 @@
 package merk
 
 import (
+	"bytes"
 	"fmt"
 	"math"
 )
@@ -10,85 +11,165 @@ type OPType uint8
 const (
 	Put OPType = 1 << iota
 	Del
+	PutIfAbsent    // put only if the key is absent
+	CompareAndSwap // put only if the current value is equal to E
+	DeleteIfExists // delete, tolerating the absence of the key
+	Merge          // combine V with the current value by the merge function named M
 )
 
 type OP struct {
 	O OPType
 	K []byte
 	V []byte
+	E []byte // expected value of CompareAndSwap
+	M string // name of the merge function of Merge, see RegisterMergeFunc
+
+	applied bool
+}
+
+// Applied reports whether the op changed the tree in the last Apply, false if its condition is not met
+func (op *OP) Applied() bool {
+	return op.applied
+}
+
+// resetApplied clears the flags set by the last Apply
+func (b Batch) resetApplied() {
+	for _, op := range b {
+		op.applied = false
+	}
+}
+
+// insertions returns the ops which insert when the keys are absent, and marks the rest as not applied
+func insertions(batch Batch) (Batch, error) {
+	var filtered Batch
+
+	for i, op := range batch {
+		switch op.O {
+		case Put, PutIfAbsent, Merge:
+			if filtered != nil {
+				filtered = append(filtered, op)
+			}
+			continue
+		case Del:
+			return nil, fmt.Errorf("%w: %v", ErrDeleteMissing, op.K)
+		}
+
+		// copy on the first op skipped
+		op.applied = false
+		if filtered == nil {
+			filtered = append(make(Batch, 0, len(batch)-1), batch[:i]...)
+		}
+	}
+
+	if filtered == nil {
+		return batch, nil
+	}
+
+	return filtered, nil
 }
 
-func applyTo(maybeTree *Tree, batch Batch) (*Tree, [][]byte, error) {
+// applyTo applies the batch to the tree, returns the new root and the deleted nodes
+func applyTo(w *workers, maybeTree *Tree, batch Batch) (*Tree, []*Tree, error) {
 	if maybeTree == nil {
-		t, err := build(batch)
+		t, err := build(w, batch)
 		return t, nil, err
 	}
 
-	return apply(maybeTree, batch)
+	return apply(w, maybeTree, batch)
 }
 
-func build(batch Batch) (*Tree, error) {
+func build(w *workers, batch Batch) (*Tree, error) {
+	batch, err := insertions(batch)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
 	var midIndex int = len(batch) / 2
 	var midKey []byte = batch[midIndex].K
-	var midOP OPType = batch[midIndex].O
 	var midValue []byte = batch[midIndex].V
-	if midOP == Del {
-		return nil, fmt.Errorf("tried to delete non-existent key %v", midKey)
+	if batch[midIndex].O == Merge {
+		if midValue, err = merge(batch[midIndex], nil, false); err != nil {
+			return nil, err
+		}
 	}
+	batch[midIndex].applied = true
 
 	midTree := newTree(midKey, midValue)
-	midTree, _, err := recurse(midTree, batch, midIndex, true)
+	midTree, _, err = recurse(w, midTree, batch, midIndex, true)
 
 	return midTree, err
 }
 
-func apply(tree *Tree, batch Batch) (*Tree, [][]byte, error) {
+func apply(w *workers, tree *Tree, batch Batch) (*Tree, []*Tree, error) {
 	var (
-		deletedKeys, deletedKeysRight [][]byte
-		leftBatch, rightBatch         Batch
-		err                           error
+		deleted, deletedRight []*Tree
+		leftBatch, rightBatch Batch
 	)
 
 	found, mid := binarySearchBatch(tree.Key(), batch)
 
 	if found {
-		switch batch[mid].O {
-		case Del:
-			maybeTree := remove(tree)
+		op := batch[mid]
+		op.applied = true
+
+		switch op.O {
+		case Del, DeleteIfExists:
+			maybeTree, err := remove(tree)
+			if err != nil {
+				return nil, nil, err
+			}
 
 			leftBatch = batch[:mid]
 			rightBatch = batch[mid+1:]
 
 			if len(leftBatch) != 0 {
-				maybeTree, deletedKeys, err = applyTo(maybeTree, leftBatch)
+				maybeTree, deleted, err = applyTo(w, maybeTree, leftBatch)
 				if err != nil {
 					return nil, nil, err
 				}
 			}
 
 			if len(rightBatch) != 0 {
-				maybeTree, deletedKeysRight, err = applyTo(maybeTree, rightBatch)
+				maybeTree, deletedRight, err = applyTo(w, maybeTree, rightBatch)
 				if err != nil {
 					return nil, nil, err
 				}
 			}
 
-			deletedKeys = append(deletedKeys, deletedKeysRight...)
-			deletedKeys = append(deletedKeys, tree.Key())
+			deleted = append(deleted, deletedRight...)
+			deleted = append(deleted, tree)
 
-			return maybeTree, deletedKeys, nil
+			return maybeTree, deleted, nil
+		case PutIfAbsent:
+			op.applied = false
+		case Merge:
+			value, err := merge(op, tree.Value(), true)
+			if err != nil {
+				return nil, nil, err
+			}
+			tree.withValue(value)
+		case CompareAndSwap:
+			if bytes.Equal(tree.Value(), op.E) {
+				tree.withValue(op.V)
+			} else {
+				op.applied = false
+			}
 		default:
-			tree.withValue(batch[mid].V)
+			tree.withValue(op.V)
 		}
 	}
 
-	return recurse(tree, batch, mid, found)
+	return recurse(w, tree, batch, mid, found)
 }
 
-func recurse(tree *Tree, batch Batch, mid int, exclusive bool) (*Tree, [][]byte, error) {
+func recurse(w *workers, tree *Tree, batch Batch, mid int, exclusive bool) (*Tree, []*Tree, error) {
 	var (
-		leftBatch, rightBatch             Batch
-		deletedKeysLeft, deletedKeysRight [][]byte
+		leftBatch, rightBatch     Batch
+		deletedLeft, deletedRight []*Tree
 	)
 
 	leftBatch = batch[:mid]
@@ -98,39 +179,82 @@ func recurse(tree *Tree, batch Batch, mid int, exclusive bool) (*Tree, [][]byte,
 		rightBatch = batch[mid:]
 	}
 
-	// Note: if use concurency, slow down when low spec pc
-	chErr := make(chan error, 2)
-
-	handler := func(isLeft bool, b Batch) {
-		if len(b) != 0 {
-			go func() {
-
-				err := tree.walk(isLeft, func(maybeTree *Tree) (*Tree, error) {
-					maybeTree, deletedKeys, err := applyTo(maybeTree, b)
-					if isLeft {
-						deletedKeysLeft = append(deletedKeysLeft, deletedKeys...)
-					} else {
-						deletedKeysRight = append(deletedKeysRight, deletedKeys...)
-					}
-					return maybeTree, err
-				})
-				chErr <- err
-			}()
-		} else {
-			chErr <- nil
+	handler := func(isLeft bool, b Batch, deleted *[]*Tree) func() error {
+		return func() error {
+			if len(b) == 0 {
+				return nil
+			}
+
+			return tree.walk(isLeft, func(maybeTree *Tree) (*Tree, error) {
+				maybeTree, d, err := applyTo(w, maybeTree, b)
+				*deleted = d
+				return maybeTree, err
+			})
+		}
+	}
+
+	err := w.fork(
+		w.batchParallel(len(leftBatch), len(rightBatch)),
+		handler(true, leftBatch, &deletedLeft),
+		handler(false, rightBatch, &deletedRight),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tree, err = maybeBalance(tree)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tree, append(deletedLeft, deletedRight...), nil
+}
+
+// deleteRange removes the keys in [start, end) from the tree, nil means unbounded.
+// Returns the new root and the deleted nodes.
+func deleteRange(tree *Tree, start, end []byte) (*Tree, []*Tree, error) {
+	var deleted []*Tree
+
+	walk := func(isLeft bool) error {
+		return tree.walk(isLeft, func(maybeTree *Tree) (*Tree, error) {
+			if maybeTree == nil {
+				return nil, nil
+			}
+			maybeTree, d, err := deleteRange(maybeTree, start, end)
+			deleted = append(deleted, d...)
+			return maybeTree, err
+		})
+	}
+
+	afterStart := start == nil || bytes.Compare(tree.Key(), start) >= 0
+	beforeEnd := end == nil || bytes.Compare(tree.Key(), end) < 0
+
+	if afterStart {
+		if err := walk(true); err != nil {
+			return nil, nil, err
 		}
 	}
 
-	handler(true, leftBatch)
-	handler(false, rightBatch)
+	if beforeEnd {
+		if err := walk(false); err != nil {
+			return nil, nil, err
+		}
+	}
 
-	for i := 0; i < cap(chErr); i++ {
-		if err := <-chErr; err != nil {
+	if afterStart && beforeEnd {
+		maybeTree, err := remove(tree)
+		if err != nil {
 			return nil, nil, err
 		}
+		return maybeTree, append(deleted, tree), nil
 	}
 
-	return maybeBalance(tree), append(deletedKeysLeft, deletedKeysRight...), nil
+	tree, err := maybeBalance(tree)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tree, deleted, nil
 }
 
 func balanceFactor(tree *Tree) int8 {
@@ -140,43 +264,50 @@ func balanceFactor(tree *Tree) int8 {
 	return tree.balanceFactor()
 }
 
-func maybeBalance(tree *Tree) *Tree {
+func maybeBalance(tree *Tree) (*Tree, error) {
 	var balance int8 = balanceFactor(tree)
 	if math.Abs(float64(balance)) <= 1 {
-		return tree
+		return tree, nil
 	}
 
 	var isLeft bool = balance < 0
-	var childIsLeft bool = balanceFactor(tree.Child(isLeft)) > 0
+	var childIsLeft bool = tree.Link(isLeft).balanceFactor() > 0
 
 	if (isLeft && childIsLeft) || (!isLeft && !childIsLeft) {
-		tree.walkExpect(isLeft, func(child *Tree) *Tree { return rotate(child, !isLeft) })
+		err := tree.walkExpect(isLeft, func(child *Tree) (*Tree, error) { return rotate(child, !isLeft) })
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return rotate(tree, isLeft)
 }
 
-func rotate(tree *Tree, isLeft bool) *Tree {
-	var (
-		child           *Tree
-		maybeGrandchild *Tree
-	)
+func rotate(tree *Tree, isLeft bool) (*Tree, error) {
+	child, err := tree.detachExpect(isLeft)
+	if err != nil {
+		return nil, err
+	}
 
-	child = tree.detachExpect(isLeft)
-	maybeGrandchild = child.detach(!isLeft)
+	maybeGrandchild, err := child.detach(!isLeft)
+	if err != nil {
+		return nil, err
+	}
 
 	if maybeGrandchild != nil {
 		tree.attach(isLeft, maybeGrandchild)
 	}
-	tree = maybeBalance(tree)
+
+	if tree, err = maybeBalance(tree); err != nil {
+		return nil, err
+	}
 
 	child.attach(!isLeft, tree)
-	child = maybeBalance(child)
 
-	return child
+	return maybeBalance(child)
 }
 
-func remove(tree *Tree) *Tree {
+func remove(tree *Tree) (*Tree, error) {
 	var hasLeft, hasRight, isLeft bool
 
 	if tree.Link(true) != nil {
@@ -189,7 +320,7 @@ func remove(tree *Tree) *Tree {
 
 	// no child
 	if !hasLeft && !hasRight {
-		return nil
+		return nil, nil
 	}
 
 	isLeft = tree.ChildHeight(true) > tree.ChildHeight(false)
@@ -200,15 +331,24 @@ func remove(tree *Tree) *Tree {
 	}
 
 	// two children, promote edge of taller child
-	tallChild := tree.detachExpect(isLeft)
-	shortChild := tree.detachExpect(!isLeft)
+	tallChild, err := tree.detachExpect(isLeft)
+	if err != nil {
+		return nil, err
+	}
+
+	shortChild, err := tree.detachExpect(!isLeft)
+	if err != nil {
+		return nil, err
+	}
+
 	return promoteEdge(tallChild, shortChild, !isLeft)
 }
 
-func promoteEdge(tree, attach *Tree, isLeft bool) *Tree {
-	var edge, maybeChild *Tree
-
-	edge, maybeChild = removeEdge(tree, isLeft)
+func promoteEdge(tree, attach *Tree, isLeft bool) (*Tree, error) {
+	edge, maybeChild, err := removeEdge(tree, isLeft)
+	if err != nil {
+		return nil, err
+	}
 
 	edge.attach(!isLeft, maybeChild)
 	edge.attach(isLeft, attach)
@@ -216,21 +356,31 @@ func promoteEdge(tree, attach *Tree, isLeft bool) *Tree {
 	return maybeBalance(edge)
 }
 
-func removeEdge(t *Tree, isLeft bool) (*Tree, *Tree) {
-	var tree, edge, maybeChild *Tree
-
+func removeEdge(t *Tree, isLeft bool) (*Tree, *Tree, error) {
 	if t.Link(isLeft) == nil {
-		tree = t.detach(!isLeft)
-		return t, tree
+		tree, err := t.detach(!isLeft)
+		if err != nil {
+			return nil, nil, err
+		}
+		return t, tree, nil
 	}
 
-	child := t.detachExpect(isLeft)
-	tree = t
+	child, err := t.detachExpect(isLeft)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	edge, maybeChild, err := removeEdge(child, isLeft)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	edge, maybeChild = removeEdge(child, isLeft)
+	t.attach(isLeft, maybeChild)
 
-	tree.attach(isLeft, maybeChild)
-	tree = maybeBalance(tree)
+	tree, err := maybeBalance(t)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return edge, tree
+	return edge, tree, nil
 }
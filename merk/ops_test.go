@@ -2,47 +2,48 @@ package merk
 
 import (
 	"github.com/stretchr/testify/assert"
+	"strconv"
 	"testing"
 )
 
 func TestBuild(t *testing.T) {
 	var b Batch
 
-	op0 := &OP{Put, []byte("0"), []byte("value")}
-	op1 := &OP{Put, []byte("1"), []byte("value")}
-	op2 := &OP{Put, []byte("2"), []byte("value")}
-	op3 := &OP{Put, []byte("3"), []byte("value")}
-	op4 := &OP{Put, []byte("4"), []byte("value")}
-	op5 := &OP{Put, []byte("5"), []byte("value")}
-	op6 := &OP{Put, []byte("6"), []byte("value")}
-	op7 := &OP{Put, []byte("7"), []byte("value")}
-	op8 := &OP{Put, []byte("8"), []byte("value")}
-	op9 := &OP{Put, []byte("9"), []byte("value")}
+	op0 := &OP{O: Put, K: []byte("0"), V: []byte("value")}
+	op1 := &OP{O: Put, K: []byte("1"), V: []byte("value")}
+	op2 := &OP{O: Put, K: []byte("2"), V: []byte("value")}
+	op3 := &OP{O: Put, K: []byte("3"), V: []byte("value")}
+	op4 := &OP{O: Put, K: []byte("4"), V: []byte("value")}
+	op5 := &OP{O: Put, K: []byte("5"), V: []byte("value")}
+	op6 := &OP{O: Put, K: []byte("6"), V: []byte("value")}
+	op7 := &OP{O: Put, K: []byte("7"), V: []byte("value")}
+	op8 := &OP{O: Put, K: []byte("8"), V: []byte("value")}
+	op9 := &OP{O: Put, K: []byte("9"), V: []byte("value")}
 
 	b = append(b, op0, op1, op2, op3, op4, op5, op6, op7, op8, op9)
 
-	tree, _ := build(b)
+	tree, _ := build(nil, b)
 
 	assert.EqualValues(t, []byte("5"), tree.Key())
-	assert.EqualValues(t, []byte("2"), tree.Child(true).Key())
-	assert.EqualValues(t, []byte("1"), tree.Child(true).Child(true).Key())
-	assert.EqualValues(t, []byte("0"), tree.Child(true).Child(true).Child(true).Key())
-	assert.EqualValues(t, []byte("4"), tree.Child(true).Child(false).Key())
-	assert.EqualValues(t, []byte("3"), tree.Child(true).Child(false).Child(true).Key())
-	assert.EqualValues(t, []byte("8"), tree.Child(false).Key())
-	assert.EqualValues(t, []byte("7"), tree.Child(false).Child(true).Key())
-	assert.EqualValues(t, []byte("6"), tree.Child(false).Child(true).Child(true).Key())
-	assert.EqualValues(t, []byte("9"), tree.Child(false).Child(false).Key())
+	assert.EqualValues(t, []byte("2"), tree.mustChild(true).Key())
+	assert.EqualValues(t, []byte("1"), tree.mustChild(true).mustChild(true).Key())
+	assert.EqualValues(t, []byte("0"), tree.mustChild(true).mustChild(true).mustChild(true).Key())
+	assert.EqualValues(t, []byte("4"), tree.mustChild(true).mustChild(false).Key())
+	assert.EqualValues(t, []byte("3"), tree.mustChild(true).mustChild(false).mustChild(true).Key())
+	assert.EqualValues(t, []byte("8"), tree.mustChild(false).Key())
+	assert.EqualValues(t, []byte("7"), tree.mustChild(false).mustChild(true).Key())
+	assert.EqualValues(t, []byte("6"), tree.mustChild(false).mustChild(true).mustChild(true).Key())
+	assert.EqualValues(t, []byte("9"), tree.mustChild(false).mustChild(false).Key())
 }
 
 func TestSortBatch(t *testing.T) {
 	var b, expect Batch
 
-	op0 := &OP{Put, []byte("key0"), []byte("value0")}
-	op1 := &OP{Put, []byte("key1"), []byte("value1")}
-	op2 := &OP{Del, []byte("key2"), []byte("")}
-	op3 := &OP{Put, []byte("key3"), []byte("value3")}
-	op4 := &OP{Put, []byte("key4"), []byte("")}
+	op0 := &OP{O: Put, K: []byte("key0"), V: []byte("value0")}
+	op1 := &OP{O: Put, K: []byte("key1"), V: []byte("value1")}
+	op2 := &OP{O: Del, K: []byte("key2"), V: []byte("")}
+	op3 := &OP{O: Put, K: []byte("key3"), V: []byte("value3")}
+	op4 := &OP{O: Put, K: []byte("key4"), V: []byte("")}
 
 	b = append(b, op4, op1, op2, op0, op3)
 	expect = append(expect, op0, op1, op2, op3, op4)
@@ -51,3 +52,128 @@ func TestSortBatch(t *testing.T) {
 
 	assert.EqualValues(t, expect, b)
 }
+
+func TestConditionalOPs(t *testing.T) {
+	m, err := New(NewMemDB(), DefaultOptions())
+	assert.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 10, Put, "value"), true)
+	assert.NoError(t, err)
+
+	var batch Batch = []*OP{
+		&OP{O: PutIfAbsent, K: []byte("key1000"), V: []byte("value2")},
+		&OP{O: CompareAndSwap, K: []byte("key1001"), V: []byte("value2"), E: []byte("value")},
+		&OP{O: CompareAndSwap, K: []byte("key1002"), V: []byte("value2"), E: []byte("other")},
+		&OP{O: DeleteIfExists, K: []byte("key1003")},
+		&OP{O: DeleteIfExists, K: []byte("key1003a")},
+		&OP{O: CompareAndSwap, K: []byte("key1003b"), V: []byte("value2")},
+		&OP{O: PutIfAbsent, K: []byte("key1010"), V: []byte("value2")},
+	}
+
+	deleted, err := m.Apply(batch, true)
+	assert.NoError(t, err)
+	assert.EqualValues(t, [][]byte{[]byte("key1003")}, deleted)
+
+	applied := make([]bool, len(batch))
+	for i, op := range batch {
+		applied[i] = op.Applied()
+	}
+	assert.EqualValues(t, []bool{false, true, false, true, false, false, true}, applied)
+
+	assert.EqualValues(t, []byte("value"), mustGet(t, m, []byte("key1000")))
+	assert.EqualValues(t, []byte("value2"), mustGet(t, m, []byte("key1001")))
+	assert.EqualValues(t, []byte("value"), mustGet(t, m, []byte("key1002")))
+	assert.False(t, mustHas(t, m, []byte("key1003")))
+	assert.False(t, mustHas(t, m, []byte("key1003b")))
+	assert.EqualValues(t, []byte("value2"), mustGet(t, m, []byte("key1010")))
+	assert.NoError(t, m.Tree.verify())
+
+	// the flags of the previous apply are reset, also on failure
+	failed := Batch{&OP{O: Put, K: []byte("key1000"), V: []byte("value3")}, &OP{O: Del, K: []byte("key1011")}}
+	_, err = m.Apply(failed, true)
+	assert.Error(t, err)
+	assert.False(t, failed[0].Applied())
+	assert.EqualValues(t, []byte("value"), mustGet(t, m, []byte("key1000")))
+
+	_, err = m.Apply(Batch{batch[1]}, true)
+	assert.NoError(t, err)
+	assert.False(t, batch[1].Applied())
+
+	// ops skipped on empty tree
+	m, err = New(NewMemDB(), DefaultOptions())
+	assert.NoError(t, err)
+
+	batch = []*OP{&OP{O: DeleteIfExists, K: []byte("key")}}
+	_, err = m.Apply(batch, true)
+	assert.NoError(t, err)
+	assert.False(t, batch[0].Applied())
+	assert.Nil(t, m.Tree)
+
+	batch = []*OP{&OP{O: OPType(0), K: []byte("key")}}
+	_, err = m.Apply(batch, true)
+	assert.Error(t, err)
+}
+
+func TestDeleteRange(t *testing.T) {
+	cases := []struct {
+		start, end int // -1 means unbounded
+	}{
+		{10, 20}, {0, 990}, {-1, 500}, {500, -1}, {-1, -1}, {333, 334}, {1, 999}, {400, 400},
+	}
+
+	key := func(i int) []byte {
+		if i < 0 {
+			return nil
+		}
+		return []byte("key" + strconv.Itoa(1000+i))
+	}
+
+	for _, c := range cases {
+		db := NewMemDB()
+		m, err := New(db, DefaultOptions())
+		assert.NoError(t, err)
+
+		_, err = m.Apply(buildSeqBatch(0, 1000, Put, "value"), true)
+		assert.NoError(t, err)
+
+		deleted, err := m.DeleteRange(key(c.start), key(c.end), true)
+		assert.NoError(t, err)
+
+		expected := [][]byte{}
+		for i := 0; i < 1000; i++ {
+			if (c.start < 0 || i >= c.start) && (c.end < 0 || i < c.end) {
+				expected = append(expected, key(i))
+			} else {
+				assert.True(t, mustHas(t, m, key(i)))
+			}
+		}
+		assert.EqualValues(t, len(expected), len(deleted))
+		assert.EqualValues(t, expected, deleted)
+
+		if m.Tree != nil {
+			assert.NoError(t, m.Tree.verify())
+			assertBalanced(t, m.Tree)
+		}
+		assert.EqualValues(t, reachableNodes(t, db, m.RootHash()), storedNodes(t, db))
+	}
+
+	m, err := New(NewMemDB(), DefaultOptions())
+	assert.NoError(t, err)
+	_, err = m.DeleteRange(key(2), key(1), true)
+	assert.Error(t, err)
+}
+
+// assertBalanced asserts the heights of links and the balance of each node
+func assertBalanced(t *testing.T, tree *Tree) uint8 {
+	var heights [2]uint8
+	for i, isLeft := range []bool{true, false} {
+		if child := tree.mustChild(isLeft); child != nil {
+			heights[i] = assertBalanced(t, child)
+		}
+	}
+
+	assert.EqualValues(t, heights, tree.ChildHeights())
+	assert.True(t, int(heights[0])-int(heights[1]) <= 1 && int(heights[1])-int(heights[0]) <= 1, "unbalanced %s", tree.Key())
+
+	return tree.height()
+}
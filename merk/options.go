@@ -0,0 +1,161 @@
+package merk
+
+import (
+	"errors"
+	"fmt"
+	badger "github.com/dgraph-io/badger/v2"
+	"github.com/dgraph-io/badger/v2/options"
+	"runtime"
+)
+
+const (
+	DefaultLevels            = 1
+	DefaultMaxTableSize      = 64 << 20
+	DefaultValueLogFileSize  = 1<<30 - 1
+	DefaultKeepRecent        = 1
+	DefaultMinParallelBatch  = 1000
+	DefaultMinParallelHeight = 10
+	DefaultNodeCacheSize     = 10000
+)
+
+// Options configures Merk and the badger backend.
+// Levels, ReadOnly, KeepRecent, KeepEvery, the parallelism and NodeCacheSize are used by New,
+// the rest are used by NewBadger.
+type Options struct {
+	// Levels is the number of levels below the root kept in memory after commit,
+	// deeper nodes are pruned and fetched from db on demand
+	Levels uint8
+
+	// ReadOnly disallows commit and snapshot, and opens badger in read only mode
+	ReadOnly bool
+
+	// KeepRecent is the number of recent versions retained, 0 means all versions
+	KeepRecent uint64
+
+	// KeepEvery retains every version which is a multiple of it besides the recent ones, 0 means none
+	KeepEvery uint64
+
+	// MaxWorkers is the number of goroutines apply and commit may run besides the caller,
+	// 0 means sequential
+	MaxWorkers int
+
+	// MinParallelBatch is the batch size for both children from which apply runs them in parallel
+	MinParallelBatch int
+
+	// MinParallelHeight is the subtree height from which commit runs the children in parallel
+	MinParallelHeight uint8
+
+	// NodeCacheSize is the number of the fetched nodes kept in memory, 0 disables the cache
+	NodeCacheSize int
+
+	// Compression of badger tables
+	Compression options.CompressionType
+
+	// SyncWrites makes badger sync every write to disk
+	SyncWrites bool
+
+	// MaxTableSize is the badger memtable size in bytes, 0 means DefaultMaxTableSize
+	MaxTableSize int64
+
+	// ValueLogFileSize is the max size of a badger value log file in bytes, 0 means DefaultValueLogFileSize
+	ValueLogFileSize int64
+
+	// Logger of badger, nothing is logged if nil
+	Logger badger.Logger
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Levels:            DefaultLevels,
+		ReadOnly:          false,
+		KeepRecent:        DefaultKeepRecent,
+		KeepEvery:         0,
+		MaxWorkers:        runtime.NumCPU(),
+		MinParallelBatch:  DefaultMinParallelBatch,
+		MinParallelHeight: DefaultMinParallelHeight,
+		NodeCacheSize:     DefaultNodeCacheSize,
+		Compression:       options.Snappy,
+		SyncWrites:        true,
+		MaxTableSize:      DefaultMaxTableSize,
+		ValueLogFileSize:  DefaultValueLogFileSize,
+		Logger:            nil,
+	}
+}
+
+func (o Options) validate() error {
+	if o.MaxWorkers < 0 {
+		return fmt.Errorf("max workers must not be negative, %v", o.MaxWorkers)
+	}
+
+	if o.MinParallelBatch < 0 {
+		return fmt.Errorf("min parallel batch must not be negative, %v", o.MinParallelBatch)
+	}
+
+	if o.NodeCacheSize < 0 {
+		return fmt.Errorf("node cache size must not be negative, %v", o.NodeCacheSize)
+	}
+
+	return nil
+}
+
+// validateBadger validates the options used by NewBadger, zero sizes mean the defaults
+func (o Options) validateBadger() error {
+	switch o.Compression {
+	case options.None, options.Snappy, options.ZSTD:
+	default:
+		return fmt.Errorf("unknown compression type, %v", o.Compression)
+	}
+
+	if o.MaxTableSize < 0 {
+		return fmt.Errorf("max table size must not be negative, %v", o.MaxTableSize)
+	}
+
+	// the range badger accepts
+	if o.ValueLogFileSize != 0 && (o.ValueLogFileSize < 1<<20 || o.ValueLogFileSize >= 2<<30) {
+		return fmt.Errorf("value log file size must be in [1MB, 2GB), %v", o.ValueLogFileSize)
+	}
+
+	return nil
+}
+
+// retains reports whether the version is retained when the latest version is committed
+func (o Options) retains(version, latest uint64) bool {
+	if o.KeepRecent == 0 || version+o.KeepRecent > latest {
+		return true
+	}
+	return o.KeepEvery > 0 && version%o.KeepEvery == 0
+}
+
+func (o Options) badgerOptions(dir string) (badger.Options, error) {
+	if dir == "" {
+		return badger.Options{}, errors.New("empty db dir")
+	}
+
+	// See available options
+	// https://godoc.org/github.com/dgraph-io/badger#Options
+	ops := badger.DefaultOptions(dir)
+
+	if o.Logger == nil {
+		ops = ops.WithLogger(nullLog{})
+	} else {
+		ops = ops.WithLogger(o.Logger)
+	}
+
+	// Explicitly specify compression
+	// Because the default compression with CGO is ZSTD, and without CGO it's Snappy.
+	ops = ops.WithCompression(o.Compression)
+
+	ops = ops.WithSyncWrites(o.SyncWrites)
+	if o.MaxTableSize == 0 {
+		o.MaxTableSize = DefaultMaxTableSize
+	}
+	if o.ValueLogFileSize == 0 {
+		o.ValueLogFileSize = DefaultValueLogFileSize
+	}
+
+	ops = ops.WithMaxTableSize(o.MaxTableSize)
+	ops = ops.WithValueLogFileSize(o.ValueLogFileSize)
+	ops = ops.WithReadOnly(o.ReadOnly)
+
+	return ops, nil
+}
@@ -0,0 +1,72 @@
+package merk
+
+import (
+	"github.com/dgraph-io/badger/v2/options"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestValidateOptions(t *testing.T) {
+	require.NoError(t, DefaultOptions().validate())
+	require.NoError(t, DefaultOptions().validateBadger())
+
+	opts := DefaultOptions()
+	opts.Compression = options.CompressionType(10)
+	require.Error(t, opts.validateBadger())
+
+	opts = DefaultOptions()
+	opts.MaxTableSize = -1
+	require.Error(t, opts.validateBadger())
+
+	opts = DefaultOptions()
+	opts.ValueLogFileSize = 1 << 10
+	require.Error(t, opts.validateBadger())
+
+	_, err := NewBadger("", DefaultOptions())
+	require.Error(t, err)
+
+	// the badger options are not used by New, and zero sizes mean the defaults
+	require.NoError(t, Options{}.validateBadger())
+
+	m, err := New(NewMemDB(), Options{})
+	require.NoError(t, err)
+	_, err = m.Apply(buildSeqBatch(0, 10, Put, "value"), true)
+	require.NoError(t, err)
+}
+
+func TestOptionsLevels(t *testing.T) {
+	var batch Batch
+
+	opts := DefaultOptions()
+	opts.Levels = 2
+
+	m, err := New(NewMemDB(), opts)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		batch = append(batch, &OP{O: Put, K: []byte{byte(i)}, V: []byte("value")})
+	}
+	_, err = m.Apply(batch, true)
+	require.NoError(t, err)
+
+	require.EqualValues(t, StoredLink, m.Tree.mustChild(true).Link(true).linkType())
+	require.EqualValues(t, StoredLink, m.Tree.mustChild(false).Link(false).linkType())
+	require.EqualValues(t, PrunedLink, m.Tree.mustChild(true).mustChild(true).Link(true).linkType())
+}
+
+func TestOptionsReadOnly(t *testing.T) {
+	var batch Batch = []*OP{&OP{O: Put, K: []byte("key"), V: []byte("value")}}
+
+	opts := DefaultOptions()
+	opts.ReadOnly = true
+
+	m, err := New(NewMemDB(), opts)
+	require.NoError(t, err)
+
+	_, err = m.Apply(batch, false)
+	require.NoError(t, err)
+	require.Error(t, m.Commit())
+
+	_, err = m.TakeDBSnapshot()
+	require.Error(t, err)
+}
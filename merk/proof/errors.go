@@ -0,0 +1,13 @@
+package proof
+
+import (
+	"errors"
+)
+
+// Errors are wrapped with the details, use errors.Is to branch.
+// Prove and ProveRange also return merk errors, e.g. merk.ErrEmptyTree and merk.ErrUnsortedBatch.
+var (
+	ErrProofMismatch   = errors.New("proof did not match expected hash")
+	ErrMalformedProof  = errors.New("malformed proof")
+	ErrIncompleteProof = errors.New("proof omits keys in range")
+)
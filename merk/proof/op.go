@@ -71,7 +71,7 @@ func encode(ops []*OP) (buf []byte) {
 	return
 }
 
-func decode(buf []byte) (*OP, []byte) {
+func decode(buf []byte) (*OP, []byte, error) {
 	var (
 		t                  byte
 		h                  m.Hash
@@ -79,34 +79,46 @@ func decode(buf []byte) (*OP, []byte) {
 		hBytes, key, value []byte
 	)
 
+	errShort := fmt.Errorf("%w: unexpected end", ErrMalformedProof)
+
 	t, buf = buf[0], buf[1:]
 
 	switch t {
-	case byte(0x01):
-		hBytes, buf = buf[:m.HashSize], buf[m.HashSize:]
-		copy(h[:], hBytes)
-		return &OP{t: Push, n: &Node{t: Hash, h: h}}, buf
-
-	case byte(0x02):
+	case byte(0x01), byte(0x02):
+		if len(buf) < m.HashSize {
+			return nil, nil, errShort
+		}
 		hBytes, buf = buf[:m.HashSize], buf[m.HashSize:]
 		copy(h[:], hBytes)
-		return &OP{t: Push, n: &Node{t: KVHash, h: h}}, buf
+		if t == byte(0x01) {
+			return &OP{t: Push, n: &Node{t: Hash, h: h}}, buf, nil
+		}
+		return &OP{t: Push, n: &Node{t: KVHash, h: h}}, buf, nil
 
 	case byte(0x03):
+		if len(buf) < 4 {
+			return nil, nil, errShort
+		}
 		kLen, buf = bytesutil.Uint32BE(buf[:4]), buf[4:]
+		if uint64(len(buf)) < uint64(kLen)+4 {
+			return nil, nil, errShort
+		}
 		key, buf = buf[:kLen], buf[kLen:]
 		vLen, buf = bytesutil.Uint32BE(buf[:4]), buf[4:]
+		if uint64(len(buf)) < uint64(vLen) {
+			return nil, nil, errShort
+		}
 		value, buf = buf[:vLen], buf[vLen:]
-		return &OP{t: Push, n: &Node{t: KV, k: key, v: value}}, buf
+		return &OP{t: Push, n: &Node{t: KV, k: key, v: value}}, buf, nil
 
 	case byte(0x10):
-		return &OP{t: Parent}, buf
+		return &OP{t: Parent}, buf, nil
 
 	case byte(0x11):
-		return &OP{t: Child}, buf
+		return &OP{t: Child}, buf, nil
 
 	default:
-		panic("BUG: undefined proof op type")
+		return nil, nil, fmt.Errorf("%w: undefined op type %v", ErrMalformedProof, t)
 	}
 }
 
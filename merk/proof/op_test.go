@@ -1,6 +1,7 @@
 package proof
 
 import (
+	"errors"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/blake2b"
 	"testing"
@@ -17,15 +18,28 @@ func TestEncodeDecode(t *testing.T) {
 
 	buf := encode(ops)
 
-	var op *OP
-	op, buf = decode(buf)
+	var (
+		op  *OP
+		err error
+	)
+	op, buf, err = decode(buf)
+	require.NoError(t, err)
 	require.EqualValues(t, op1, op)
-	op, buf = decode(buf)
+	op, buf, err = decode(buf)
+	require.NoError(t, err)
 	require.EqualValues(t, op2, op)
-	op, buf = decode(buf)
+	op, buf, err = decode(buf)
+	require.NoError(t, err)
 	require.EqualValues(t, op3, op)
-	op, buf = decode(buf)
+	op, buf, err = decode(buf)
+	require.NoError(t, err)
 	require.EqualValues(t, op4, op)
-	op, buf = decode(buf)
+	op, buf, err = decode(buf)
+	require.NoError(t, err)
 	require.EqualValues(t, op5, op)
+
+	_, _, err = decode(encode(ops)[:10])
+	require.True(t, errors.Is(err, ErrMalformedProof))
+	_, _, err = decode([]byte{0xff})
+	require.True(t, errors.Is(err, ErrMalformedProof))
 }
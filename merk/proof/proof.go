@@ -2,36 +2,38 @@ package proof
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	m "github.com/tak1827/merk-go/merk"
 )
 
 func Prove(tree *m.Tree, keys [][]byte) ([]byte, error) {
 	if tree == nil {
-		return nil, errors.New("cannot create proof for empty tree")
+		return nil, fmt.Errorf("%w: cannot create proof", m.ErrEmptyTree)
 	}
 
 	// ensure keys are sorted and unique
 	var prevKey []byte
 	for _, key := range keys {
 		if bytes.Compare(key, prevKey) == -1 {
-			return nil, errors.New("keys in batch must be sorted")
+			return nil, fmt.Errorf("%w: %v", m.ErrUnsortedBatch, key)
 		} else if bytes.Equal(key, prevKey) {
-			return nil, fmt.Errorf("keys in batch must be unique, %v", key)
+			return nil, fmt.Errorf("%w: %v", m.ErrDuplicateKey, key)
 		}
 		prevKey = key
 	}
 
-	return ProveUnchecked(tree, keys), nil
+	return ProveUnchecked(tree, keys)
 }
 
-func ProveUnchecked(tree *m.Tree, keys [][]byte) []byte {
-	ops, _ := createProof(tree, keys)
-	return encode(ops)
+func ProveUnchecked(tree *m.Tree, keys [][]byte) ([]byte, error) {
+	ops, _, err := createProof(tree, keys)
+	if err != nil {
+		return nil, err
+	}
+	return encode(ops), nil
 }
 
-func createProof(tree *m.Tree, keys [][]byte) ([]*OP, []bool) {
+func createProof(tree *m.Tree, keys [][]byte) ([]*OP, []bool, error) {
 	var leftKeys, rightKeys [][]byte
 
 	found, mid := m.BinarySearch(tree.Key(), keys)
@@ -42,8 +44,15 @@ func createProof(tree *m.Tree, keys [][]byte) ([]*OP, []bool) {
 		leftKeys, rightKeys = keys[:mid], keys[mid:]
 	}
 
-	proof, leftAbsence := createChildProof(tree, true, leftKeys)
-	proofRight, rightAbsence := createChildProof(tree, false, rightKeys)
+	proof, leftAbsence, err := createChildProof(tree, true, leftKeys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proofRight, rightAbsence, err := createChildProof(tree, false, rightKeys)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	hasLeft, hasRight := len(proof) != 0, len(proofRight) != 0
 
@@ -62,24 +71,27 @@ func createProof(tree *m.Tree, keys [][]byte) ([]*OP, []bool) {
 		proof = append(proof, &OP{t: Child})
 	}
 
-	return proof, []bool{leftAbsence[0], rightAbsence[1]}
+	return proof, []bool{leftAbsence[0], rightAbsence[1]}, nil
 }
 
-func createChildProof(tree *m.Tree, isLeft bool, keys [][]byte) ([]*OP, []bool) {
+func createChildProof(tree *m.Tree, isLeft bool, keys [][]byte) ([]*OP, []bool, error) {
 	var l m.Link = tree.Link(isLeft)
 
 	if len(keys) == 0 && l == nil {
-		return nil, []bool{false, false}
+		return nil, []bool{false, false}, nil
 	}
 
 	if len(keys) == 0 {
-		return []*OP{newHashNode(l)}, []bool{false, false}
+		return []*OP{newHashNode(l)}, []bool{false, false}, nil
 	}
 
-	var child *m.Tree = tree.Child(isLeft)
+	child, err := tree.Child(isLeft)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	if child == nil {
-		return nil, []bool{true, true}
+		return nil, []bool{true, true}, nil
 	}
 
 	return createProof(child, keys)
@@ -1,6 +1,7 @@
 package proof
 
 import (
+	"errors"
 	"github.com/stretchr/testify/require"
 	m "github.com/tak1827/merk-go/merk"
 	"testing"
@@ -12,7 +13,7 @@ func TestProof(t *testing.T) {
 	var (
 		keys   [][]byte
 		buf    []byte
-		output [][]byte
+		output []*Result
 		err    error
 	)
 
@@ -25,62 +26,198 @@ func TestProof(t *testing.T) {
 	require.NoError(t, err)
 	output, err = Verify(buf, keys, tree.Hash())
 	require.NoError(t, err)
-	require.EqualValues(t, [][]byte{[]byte("value08")}, output)
+	require.EqualValues(t, found("value08"), output)
 
 	keys = [][]byte{[]byte("key15")}
 	buf, err = Prove(tree, keys)
 	require.NoError(t, err)
 	output, err = Verify(buf, keys, tree.Hash())
 	require.NoError(t, err)
-	require.EqualValues(t, [][]byte{[]byte("value15")}, output)
+	require.EqualValues(t, found("value15"), output)
 
 	keys = [][]byte{[]byte("key01")}
 	buf, err = Prove(tree, keys)
 	require.NoError(t, err)
 	output, err = Verify(buf, keys, tree.Hash())
 	require.NoError(t, err)
-	require.EqualValues(t, [][]byte{[]byte("value01")}, output)
+	require.EqualValues(t, found("value01"), output)
 
 	keys = [][]byte{[]byte("key01"), []byte("key15")}
 	buf, err = Prove(tree, keys)
 	require.NoError(t, err)
 	output, err = Verify(buf, keys, tree.Hash())
 	require.NoError(t, err)
-	require.EqualValues(t, [][]byte{[]byte("value01"), []byte("value15")}, output)
+	require.EqualValues(t, found("value01", "value15"), output)
 
 	keys = [][]byte{[]byte("key01"), []byte("key02"), []byte("key03"), []byte("key04")}
 	buf, err = Prove(tree, keys)
 	require.NoError(t, err)
 	output, err = Verify(buf, keys, tree.Hash())
 	require.NoError(t, err)
-	require.EqualValues(t, [][]byte{[]byte("value01"), []byte("value02"), []byte("value03"), []byte("value04")}, output)
+	require.EqualValues(t, found("value01", "value02", "value03", "value04"), output)
 
 	keys = [][]byte{[]byte("key06"), []byte("key10"), []byte("key15")}
 	buf, err = Prove(tree, keys)
 	require.NoError(t, err)
 	output, err = Verify(buf, keys, tree.Hash())
 	require.NoError(t, err)
-	require.EqualValues(t, [][]byte{[]byte("value06"), []byte("value10"), []byte("value15")}, output)
+	require.EqualValues(t, found("value06", "value10", "value15"), output)
 
 	keys = [][]byte{[]byte("key01"), []byte("key03"), []byte("key09"), []byte("key12"), []byte("key14")}
 	buf, err = Prove(tree, keys)
 	require.NoError(t, err)
 	output, err = Verify(buf, keys, tree.Hash())
 	require.NoError(t, err)
-	require.EqualValues(t, [][]byte{[]byte("value01"), []byte("value03"), []byte("value09"), []byte("value12"), []byte("value14")}, output)
+	require.EqualValues(t, found("value01", "value03", "value09", "value12", "value14"), output)
 
 	keys = [][]byte{[]byte("key02"), []byte("key03"), []byte("key05"), []byte("key07"), []byte("key09"), []byte("key10"), []byte("key12"), []byte("key13"), []byte("key15")}
 	buf, err = Prove(tree, keys)
 	require.NoError(t, err)
 	output, err = Verify(buf, keys, tree.Hash())
 	require.NoError(t, err)
-	require.EqualValues(t, [][]byte{[]byte("value02"), []byte("value03"), []byte("value05"), []byte("value07"), []byte("value09"), []byte("value10"), []byte("value12"), []byte("value13"), []byte("value15")}, output)
+	require.EqualValues(t, found("value02", "value03", "value05", "value07", "value09", "value10", "value12", "value13", "value15"), output)
+}
+
+func TestAbsenceProof(t *testing.T) {
+	tree, db := buildTree()
+	defer db.Close()
+	defer db.Destroy()
+
+	keys := [][]byte{[]byte("key00"), []byte("key01"), []byte("key055"), []byte("key08"), []byte("key16")}
+	buf, err := Prove(tree, keys)
+	require.NoError(t, err)
+	output, err := Verify(buf, keys, tree.Hash())
+	require.NoError(t, err)
+	require.EqualValues(t, []*Result{
+		&Result{},
+		&Result{Found: true, Value: []byte("value01")},
+		&Result{},
+		&Result{Found: true, Value: []byte("value08")},
+		&Result{},
+	}, output)
+}
+
+func TestEmptyValueProof(t *testing.T) {
+	db := m.NewMemDB()
+	merk, _ := m.New(db, m.DefaultOptions())
+
+	var batch m.Batch = []*m.OP{
+		&m.OP{O: m.Put, K: []byte("key01"), V: []byte{}},
+		&m.OP{O: m.Put, K: []byte("key03"), V: []byte("value03")},
+	}
+	_, err := merk.Apply(batch, true)
+	require.NoError(t, err)
+
+	keys := [][]byte{[]byte("key01"), []byte("key02")}
+	buf, err := Prove(merk.Tree, keys)
+	require.NoError(t, err)
+	output, err := Verify(buf, keys, merk.RootHash())
+	require.NoError(t, err)
+	require.True(t, output[0].Found)
+	require.Empty(t, output[0].Value)
+	require.False(t, output[1].Found)
+}
+
+func TestViewProof(t *testing.T) {
+	db := m.NewMemDB()
+	opts := m.DefaultOptions()
+	opts.KeepRecent = 0
+	merk, _ := m.New(db, opts)
+
+	var batch m.Batch = []*m.OP{
+		&m.OP{O: m.Put, K: []byte("key01"), V: []byte("value01")},
+		&m.OP{O: m.Put, K: []byte("key02"), V: []byte("value02")},
+		&m.OP{O: m.Put, K: []byte("key03"), V: []byte("value03")},
+	}
+	_, err := merk.Apply(batch, true)
+	require.NoError(t, err)
+	root := merk.RootHash()
+
+	batch = []*m.OP{&m.OP{O: m.Put, K: []byte("key02"), V: []byte("value02-2")}}
+	_, err = merk.Apply(batch, true)
+	require.NoError(t, err)
+
+	view, err := merk.At(root)
+	require.NoError(t, err)
+
+	keys := [][]byte{[]byte("key02"), []byte("key03")}
+	buf, err := Prove(view.Tree, keys)
+	require.NoError(t, err)
+	output, err := Verify(buf, keys, root)
+	require.NoError(t, err)
+	require.EqualValues(t, found("value02", "value03"), output)
+}
+
+func TestProofErrors(t *testing.T) {
+	tree, db := buildTree()
+	defer db.Close()
+	defer db.Destroy()
+
+	_, err := Prove(nil, nil)
+	require.True(t, errors.Is(err, m.ErrEmptyTree))
+
+	_, err = Prove(tree, [][]byte{[]byte("key02"), []byte("key01")})
+	require.True(t, errors.Is(err, m.ErrUnsortedBatch))
+
+	keys := [][]byte{[]byte("key08")}
+	buf, err := Prove(tree, keys)
+	require.NoError(t, err)
+
+	_, err = Verify(buf, keys, m.Hash{1})
+	require.True(t, errors.Is(err, ErrProofMismatch))
+
+	_, err = Verify(buf[:len(buf)-1], keys, tree.Hash())
+	require.True(t, errors.Is(err, ErrMalformedProof))
+
+	_, err = Verify([]byte{0x10}, keys, tree.Hash())
+	require.True(t, errors.Is(err, ErrMalformedProof))
+
+	// the pruned node is lost
+	left, err := tree.Child(true)
+	require.NoError(t, err)
+	h := left.ChildHash(true)
+	require.NoError(t, db.Delete(append(m.NodeKeyPrefix, h[:]...)))
+
+	_, err = Prove(tree, [][]byte{[]byte("key01")})
+	require.True(t, errors.Is(err, m.ErrNotFound))
+
+	_, err = ProveRange(tree, nil, []byte("key03"), 0)
+	require.True(t, errors.Is(err, m.ErrNotFound))
+}
+
+func TestForgedProof(t *testing.T) {
+	tree, db := buildTree()
+	defer db.Close()
+	defer db.Destroy()
+
+	root := &OP{t: Push, n: &Node{t: Hash, h: tree.Hash()}}
+	forged := &OP{t: Push, n: &Node{t: KV, k: []byte("zzz"), v: []byte("forged")}}
+
+	// a KV attached to the root hash as a child
+	presence := encode([]*OP{root, forged, &OP{t: Child}})
+
+	_, err := Verify(presence, [][]byte{[]byte("zzz")}, tree.Hash())
+	require.True(t, errors.Is(err, ErrMalformedProof))
+
+	// a KV with a larger key attached to the root hash as a parent
+	absence := encode([]*OP{forged, root, &OP{t: Parent}})
+
+	_, err = Verify(absence, [][]byte{[]byte("key08")}, tree.Hash())
+	require.True(t, errors.Is(err, ErrMalformedProof))
+}
+
+func found(values ...string) (results []*Result) {
+	for _, v := range values {
+		results = append(results, &Result{Found: true, Value: []byte(v)})
+	}
+	return
 }
 
 func buildTree() (*m.Tree, m.DB) {
 	var batch m.Batch
 
-	merk, db, _ := m.New(testDBDir)
+	db, _ := m.NewBadger(testDBDir, m.DefaultOptions())
+	merk, _ := m.New(db, m.DefaultOptions())
 
 	op01 := &m.OP{O: m.Put, K: []byte("key01"), V: []byte("value01")}
 	op02 := &m.OP{O: m.Put, K: []byte("key02"), V: []byte("value02")}
@@ -0,0 +1,143 @@
+package proof
+
+import (
+	"bytes"
+	"fmt"
+	m "github.com/tak1827/merk-go/merk"
+)
+
+type Pair struct {
+	Key   []byte
+	Value []byte
+}
+
+// ProveRange creates a proof of the key/values in [start, end), at most limit pairs when limit > 0.
+// The proof also contains the nodes next to the range, which prove that nothing in the range is omitted.
+// nil start/end means unbounded.
+func ProveRange(tree *m.Tree, start, end []byte, limit int) ([]byte, error) {
+	if tree == nil {
+		return nil, fmt.Errorf("%w: cannot create proof", m.ErrEmptyTree)
+	}
+
+	if start != nil && end != nil && bytes.Compare(start, end) > 0 {
+		return nil, fmt.Errorf("%w, start: %v, end: %v", m.ErrInvalidRange, start, end)
+	}
+
+	if limit < 0 {
+		return nil, fmt.Errorf("%w: limit must not be negative, %v", m.ErrInvalidRange, limit)
+	}
+
+	var keys [][]byte
+
+	// left boundary
+	if start != nil {
+		it := tree.ReverseIterator(nil, start)
+		if it.Next() {
+			keys = append(keys, it.Key())
+		}
+		it.Close()
+
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	it := tree.Iterator(start, nil)
+	defer it.Close()
+
+	for count := 0; it.Next(); count++ {
+		keys = append(keys, it.Key())
+
+		// right boundary
+		if (end != nil && bytes.Compare(it.Key(), end) >= 0) || (limit > 0 && count == limit) {
+			break
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	return ProveUnchecked(tree, keys)
+}
+
+// VerifyRange verifies the proof created by ProveRange with the same start, end and limit,
+// returns the key/values in the range. It fails if any key in the range is omitted from the proof.
+func VerifyRange(buf []byte, start, end []byte, limit int, expectedHash m.Hash) ([]*Pair, error) {
+	type gap struct {
+		left, right []byte // nil means unbounded
+	}
+
+	var (
+		pairs   []*Pair
+		gaps    []*gap
+		lastKey []byte
+		hasKV   bool
+		opaque  bool
+		cutoff  []byte = end
+	)
+
+	if limit < 0 {
+		return nil, fmt.Errorf("%w: limit must not be negative, %v", m.ErrInvalidRange, limit)
+	}
+
+	visit := func(n *Node) error {
+		if n.t != KV {
+			// hash of subtree or kv hides keys
+			opaque = true
+			return nil
+		}
+
+		if hasKV && bytes.Compare(n.k, lastKey) <= 0 {
+			return fmt.Errorf("%w: incorrect key ordering key: %v", ErrMalformedProof, string(n.k))
+		}
+
+		if opaque {
+			if hasKV {
+				gaps = append(gaps, &gap{left: lastKey, right: n.k})
+			} else {
+				gaps = append(gaps, &gap{right: n.k})
+			}
+		}
+
+		if (start == nil || bytes.Compare(n.k, start) >= 0) && (end == nil || bytes.Compare(n.k, end) < 0) {
+			pairs = append(pairs, &Pair{Key: n.k, Value: n.v})
+		}
+
+		lastKey, hasKV, opaque = n.k, true, false
+		return nil
+	}
+
+	hash, err := execute(buf, visit)
+	if err != nil {
+		return nil, err
+	}
+
+	if hash != expectedHash {
+		return nil, fmt.Errorf("%w, expected: %v, actual: %v", ErrProofMismatch, expectedHash, hash)
+	}
+
+	if opaque {
+		if hasKV {
+			gaps = append(gaps, &gap{left: lastKey})
+		} else {
+			gaps = append(gaps, &gap{})
+		}
+	}
+
+	// the next pair of the last one proves the rest are out of the page
+	if limit > 0 && len(pairs) > limit {
+		cutoff = pairs[limit].Key
+		pairs = pairs[:limit]
+	}
+
+	// hidden keys must not be in [start, cutoff)
+	for _, g := range gaps {
+		if (g.right == nil || start == nil || bytes.Compare(start, g.right) < 0) &&
+			(g.left == nil || cutoff == nil || bytes.Compare(g.left, cutoff) < 0) {
+			return nil, fmt.Errorf("%w, between %v and %v", ErrIncompleteProof, g.left, g.right)
+		}
+	}
+
+	return pairs, nil
+}
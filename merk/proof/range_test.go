@@ -0,0 +1,122 @@
+package proof
+
+import (
+	"errors"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+)
+
+func TestRangeProof(t *testing.T) {
+	tree, db := buildTree()
+	defer db.Close()
+	defer db.Destroy()
+
+	key := func(i int) []byte {
+		return []byte("key" + strconv.Itoa(100 + i)[1:])
+	}
+
+	expect := func(from, to int) (pairs []*Pair) {
+		for i := from; i <= to; i++ {
+			pairs = append(pairs, &Pair{Key: key(i), Value: []byte("value" + string(key(i)[3:]))})
+		}
+		return
+	}
+
+	cases := []struct {
+		start, end []byte
+		limit      int
+		output     []*Pair
+	}{
+		{nil, nil, 0, expect(1, 15)},
+		{key(3), key(9), 0, expect(3, 8)},
+		{key(1), key(2), 0, expect(1, 1)},
+		{[]byte("key035"), []byte("key105"), 0, expect(4, 10)},
+		{key(14), nil, 0, expect(14, 15)},
+		{nil, key(4), 0, expect(1, 3)},
+		{key(3), key(9), 2, expect(3, 4)},
+		{key(3), key(9), 6, expect(3, 8)},
+		{key(3), key(9), 10, expect(3, 8)},
+		{nil, nil, 5, expect(1, 5)},
+		{key(5), key(5), 0, nil},
+		{[]byte("key16"), nil, 0, nil},
+		{nil, []byte("key00"), 0, nil},
+	}
+
+	for _, c := range cases {
+		buf, err := ProveRange(tree, c.start, c.end, c.limit)
+		require.NoError(t, err)
+
+		output, err := VerifyRange(buf, c.start, c.end, c.limit, tree.Hash())
+		require.NoError(t, err)
+		require.EqualValues(t, c.output, output)
+	}
+
+	// paginate
+	var (
+		output []*Pair
+		start  []byte
+	)
+	for {
+		buf, err := ProveRange(tree, start, nil, 4)
+		require.NoError(t, err)
+
+		page, err := VerifyRange(buf, start, nil, 4, tree.Hash())
+		require.NoError(t, err)
+
+		output = append(output, page...)
+		if len(page) < 4 {
+			break
+		}
+		start = append(append([]byte{}, page[len(page)-1].Key...), 0)
+	}
+	require.EqualValues(t, expect(1, 15), output)
+}
+
+func TestRangeProofIncomplete(t *testing.T) {
+	tree, db := buildTree()
+	defer db.Close()
+	defer db.Destroy()
+
+	// proof for the narrower range
+	buf, err := ProveRange(tree, []byte("key03"), []byte("key06"), 0)
+	require.NoError(t, err)
+	_, err = VerifyRange(buf, []byte("key03"), []byte("key09"), 0, tree.Hash())
+	require.Error(t, err)
+	_, err = VerifyRange(buf, []byte("key01"), []byte("key06"), 0, tree.Hash())
+	require.Error(t, err)
+
+	// truncated proof
+	buf, err = ProveRange(tree, []byte("key03"), []byte("key09"), 2)
+	require.NoError(t, err)
+	_, err = VerifyRange(buf, []byte("key03"), []byte("key09"), 0, tree.Hash())
+	require.Error(t, err)
+
+	// proof skipping key04
+	buf, err = Prove(tree, [][]byte{[]byte("key03"), []byte("key05")})
+	require.NoError(t, err)
+	_, err = VerifyRange(buf, []byte("key03"), []byte("key06"), 0, tree.Hash())
+	require.Error(t, err)
+
+	// wrong root
+	buf, err = ProveRange(tree, []byte("key03"), []byte("key09"), 0)
+	require.NoError(t, err)
+	_, err = VerifyRange(buf, []byte("key03"), []byte("key09"), 0, tree.ChildHash(true))
+	require.Error(t, err)
+}
+
+func TestForgedRangeProof(t *testing.T) {
+	tree, db := buildTree()
+	defer db.Close()
+	defer db.Destroy()
+
+	// a KV attached to the root hash, which leaves the root hash unchanged
+	buf := encode([]*OP{
+		&OP{t: Push, n: &Node{t: Hash, h: tree.Hash()}},
+		&OP{t: Push, n: &Node{t: KV, k: []byte("zzz"), v: []byte("forged")}},
+		&OP{t: Child},
+	})
+
+	_, err := VerifyRange(buf, []byte("zzz"), nil, 0, tree.Hash())
+	require.True(t, errors.Is(err, ErrMalformedProof))
+}
@@ -1,7 +1,6 @@
 package proof
 
 import (
-	"errors"
 	"fmt"
 	m "github.com/tak1827/merk-go/merk"
 )
@@ -31,12 +30,19 @@ func (t *Tree) setChild(isLeft bool, child *Tree) {
 	}
 }
 
-func (t *Tree) attach(isLeft bool, child *Tree) {
+func (t *Tree) attach(isLeft bool, child *Tree) error {
+	// the children of a hash node are not hashed, so would be unproven
+	if t.node.t == Hash {
+		return fmt.Errorf("%w: tried to attach to hash node", ErrMalformedProof)
+	}
+
 	if t.child(isLeft) != nil {
-		panic("BUG: tried to attach to child, but it is already occupied")
+		return fmt.Errorf("%w: tried to attach to child, but it is already occupied", ErrMalformedProof)
 	}
 
 	t.setChild(isLeft, child.intoHash())
+
+	return nil
 }
 
 func (t *Tree) childHash(isLeft bool) m.Hash {
@@ -78,27 +84,98 @@ func (t *Tree) hash() (h m.Hash) {
 	return t.node.h
 }
 
-func Verify(buf []byte, keys [][]byte, expectedHash m.Hash) ([][]byte, error) {
+// Result is the proven value of a queried key
+type Result struct {
+	Found bool   // false if the key is proven absent
+	Value []byte // nil if not found
+}
+
+// Verify verifies the proof created by Prove, returns the results in the same order as keys
+func Verify(buf []byte, keys [][]byte, expectedHash m.Hash) ([]*Result, error) {
+	var (
+		output   []*Result
+		key      []byte
+		keyIndex int
+		lastPush *Node
+	)
+
+	visit := func(n *Node) error {
+		if n.t == KV {
+			key = n.k
+
+			if lastPush != nil && lastPush.t == KV && string(key) <= string(lastPush.k) {
+				return fmt.Errorf("%w: incorrect key ordering key: %v", ErrMalformedProof, string(key))
+			}
+
+			for {
+				if keyIndex >= len(keys) || string(key) < string(keys[keyIndex]) {
+					break
+				} else if string(key) == string(keys[keyIndex]) {
+					// KV for queried key
+					output = append(output, &Result{Found: true, Value: n.v})
+				} else if string(key) > string(keys[keyIndex]) {
+					if lastPush == nil || lastPush.t == KV {
+						// previous push was a boundary (global edge or lower key),
+						// so this is a valid absence proof
+						output = append(output, &Result{})
+					} else {
+						// proof is incorrect since it skipped queried keys
+						return fmt.Errorf("%w: proof incorrectly formed key: %v", ErrMalformedProof, key)
+					}
+				}
+
+				keyIndex++
+			}
+		}
+
+		lastPush = n
+		return nil
+	}
+
+	hash, err := execute(buf, visit)
+	if err != nil {
+		return nil, err
+	}
+
+	// absence proofs for right edge
+	if keyIndex < len(keys) {
+		if lastPush == nil || lastPush.t != KV {
+			return nil, fmt.Errorf("%w: proof incorrectly formed", ErrMalformedProof)
+		}
+		for i := keyIndex; i < len(keys); i++ {
+			output = append(output, &Result{})
+		}
+	} else {
+		if len(keys) != len(output) {
+			return nil, fmt.Errorf("%w: output length is not same as keys length", ErrMalformedProof)
+		}
+	}
+
+	if hash != expectedHash {
+		return nil, fmt.Errorf("%w, expected: %v, actual: %v", ErrProofMismatch, expectedHash, hash)
+	}
+
+	return output, nil
+}
+
+// execute runs the proof ops and returns the root hash.
+// visit is called for each pushed node, which is in key order.
+func execute(buf []byte, visit func(n *Node) error) (m.Hash, error) {
 	var (
 		op            *OP
 		stack         []*Tree
-		output        [][]byte
 		parent, child *Tree
-		key           []byte
-		keyIndex      int
-		lastPush      *Node
+		err           error
 	)
 
-	pop := func(s []*Tree) (*Tree, []*Tree) {
-		if len(s) == 0 {
-			panic("BUG: stack underflow")
+	pop2 := func() (*Tree, *Tree, error) {
+		if len(stack) < 2 {
+			return nil, nil, fmt.Errorf("%w: stack underflow", ErrMalformedProof)
 		}
-		target := s[len(s)-1]
+		first, second := stack[len(stack)-1], stack[len(stack)-2]
+		stack = stack[:len(stack)-2]
 
-		rest := make([]*Tree, len(s)-1)
-		copy(rest, s[:len(s)-1])
-
-		return target, rest
+		return first, second, nil
 	}
 
 	for {
@@ -106,82 +183,47 @@ func Verify(buf []byte, keys [][]byte, expectedHash m.Hash) ([][]byte, error) {
 			break
 		}
 
-		op, buf = decode(buf)
+		op, buf, err = decode(buf)
+		if err != nil {
+			return m.NullHash, err
+		}
+
 		switch op.t {
 		case Parent:
-			parent, stack = pop(stack)
-			child, stack = pop(stack)
-			parent.attach(true, child)
+			if parent, child, err = pop2(); err != nil {
+				return m.NullHash, err
+			}
+			if err := parent.attach(true, child); err != nil {
+				return m.NullHash, err
+			}
 			stack = append(stack, parent)
 
 		case Child:
-			child, stack = pop(stack)
-			parent, stack = pop(stack)
-			parent.attach(false, child)
+			if child, parent, err = pop2(); err != nil {
+				return m.NullHash, err
+			}
+			if err := parent.attach(false, child); err != nil {
+				return m.NullHash, err
+			}
 			stack = append(stack, parent)
 
 		case Push:
 			stack = append(stack, &Tree{node: op.n})
 
-			if op.n.t == KV {
-				key = op.n.k
-
-				if lastPush != nil && lastPush.t == KV && string(key) <= string(lastPush.k) {
-					return nil, fmt.Errorf("incorrect key ordering key: %v", string(key))
-				}
-
-				for {
-					if keyIndex >= len(keys) || string(key) < string(keys[keyIndex]) {
-						break
-					} else if string(key) == string(keys[keyIndex]) {
-						// KV for queried key
-						output = append(output, op.n.v)
-					} else if string(key) > string(keys[keyIndex]) {
-						if lastPush == nil {
-							// previous push was a boundary (global edge or lower key),
-							// so this is a valid absence proof
-							output = append(output, []byte{})
-						} else {
-							// proof is incorrect since it skipped queried keys
-							return nil, fmt.Errorf("proof incorrectly formed key: %v", key)
-						}
-					}
-
-					keyIndex++
-				}
+			if err := visit(op.n); err != nil {
+				return m.NullHash, err
 			}
 
-			lastPush = op.n
-
 		default:
 			panic("BUG: undefined proof OP type")
 		}
 	}
 
-	// absence proofs for right edge
-	if keyIndex < len(keys) {
-		if lastPush.t != KV {
-			return nil, errors.New("proof incorrectly formed")
-		}
-		for i := keyIndex; i < len(keys); i++ {
-			output = append(output, []byte{})
-		}
-	} else {
-		if len(keys) != len(output) {
-			return nil, errors.New("output length is not same as keys length")
-		}
-	}
-
 	if len(stack) != 1 {
-		return nil, errors.New("expected proof to result in exactly one stack item")
+		return m.NullHash, fmt.Errorf("%w: expected proof to result in exactly one stack item", ErrMalformedProof)
 	}
 
 	root := stack[len(stack)-1]
-	hash := root.intoHash().hash()
 
-	if hash != expectedHash {
-		return nil, fmt.Errorf("proof did not match expected hash, expected: %v, actual: %v", expectedHash, hash)
-	}
-
-	return output, nil
+	return root.intoHash().hash(), nil
 }
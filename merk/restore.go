@@ -0,0 +1,164 @@
+package merk
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Restorer writes the tree from the chunks produced by ChunkProducer, verifying each of them
+// against the expected hash. The progress is stored with the nodes, so the restoration can be
+// resumed by NewRestorer after interruption.
+type Restorer struct {
+	db      DB
+	root    Hash
+	stack   []*Pruned // roots of the remaining chunks, the next one on the top
+	started bool      // child heights of the root are unknown until the first chunk
+}
+
+// NewRestorer returns the restorer of the tree at the root into the db,
+// resuming the restoration interrupted before if any
+func NewRestorer(db DB, root Hash) (*Restorer, error) {
+	if db == nil {
+		return nil, fmt.Errorf("%w: db is nil", ErrDBClosed)
+	}
+
+	if root == NullHash {
+		return nil, fmt.Errorf("%w: cannot restore", ErrEmptyTree)
+	}
+
+	r := &Restorer{db: db, root: root}
+
+	state, err := db.Get(RestoreKey)
+	if err == nil {
+		if err := r.unmarshalState(state); err != nil {
+			return nil, fmt.Errorf("failed to load restoration: %w", err)
+		}
+		return r, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	stored, err := storedRoot(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored == root {
+		return r, nil // already restored
+	}
+
+	if stored != NullHash {
+		return nil, fmt.Errorf("db has another tree, %v", stored)
+	}
+
+	r.stack = []*Pruned{&Pruned{h: root}}
+
+	return r, nil
+}
+
+// Done reports whether all chunks are restored
+func (r *Restorer) Done() bool {
+	return len(r.stack) == 0
+}
+
+// Next returns the root hash of the chunk expected next
+func (r *Restorer) Next() (Hash, bool) {
+	if r.Done() {
+		return NullHash, false
+	}
+	return r.stack[len(r.stack)-1].h, true
+}
+
+// Process verifies the chunk and writes its nodes. The root is stored when the last chunk is processed.
+func (r *Restorer) Process(chunk []byte) error {
+	if r.Done() {
+		return errors.New("restoration is already done")
+	}
+
+	expected := r.stack[len(r.stack)-1]
+
+	tree, trees, boundaries, err := executeChunk(chunk)
+	if err != nil {
+		return err
+	}
+
+	if tree.Hash() != expected.h {
+		return fmt.Errorf("%w, expected %v but got %v", ErrChunkMismatch, expected.h, tree.Hash())
+	}
+
+	// the child heights of boundaries are unhashed, so verified by the following chunks
+	if r.started && tree.ChildHeights() != expected.ch {
+		return fmt.Errorf("%w, child heights expected %v but got %v", ErrChunkMismatch, expected.ch, tree.ChildHeights())
+	}
+
+	// r.stack is kept until written
+	stack := make([]*Pruned, len(r.stack)-1, len(r.stack)-1+len(boundaries))
+	copy(stack, r.stack)
+	for i := len(boundaries) - 1; i >= 0; i-- {
+		stack = append(stack, boundaries[i])
+	}
+
+	wb := r.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, t := range trees {
+		h := t.Hash()
+		if err := wb.Put(append(NodeKeyPrefix, h[:]...), t.marshal(nil)); err != nil {
+			return err
+		}
+	}
+
+	if len(stack) == 0 {
+		if err := wb.Put(RootKey, r.root[:]); err != nil {
+			return err
+		}
+		if err := wb.Delete(RestoreKey); err != nil {
+			return err
+		}
+	} else {
+		if err := wb.Put(RestoreKey, r.marshalState(stack)); err != nil {
+			return err
+		}
+	}
+
+	if err := r.db.CommitWriteBatch(wb); err != nil {
+		return err
+	}
+
+	r.stack, r.started = stack, true
+
+	return nil
+}
+
+// marshalState encodes the progress as root(32) | boundaries, see appendBoundaryOP
+func (r *Restorer) marshalState(stack []*Pruned) []byte {
+	buf := append([]byte{}, r.root[:]...)
+	for _, b := range stack {
+		buf = appendBoundaryOP(buf, b)
+	}
+	return buf
+}
+
+func (r *Restorer) unmarshalState(buf []byte) error {
+	if len(buf) < HashSize || (len(buf)-HashSize)%boundaryOPSize != 0 {
+		return errors.New("malformed state")
+	}
+
+	var root Hash
+	copy(root[:], buf[:HashSize])
+
+	if root != r.root {
+		return fmt.Errorf("restoring another tree, %v", root)
+	}
+
+	for buf = buf[HashSize:]; len(buf) > 0; buf = buf[boundaryOPSize:] {
+		b := &Pruned{ch: [2]uint8{buf[1+HashSize], buf[2+HashSize]}}
+		copy(b.h[:], buf[1:1+HashSize])
+		r.stack = append(r.stack, b)
+	}
+
+	r.started = true
+
+	return nil
+}
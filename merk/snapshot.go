@@ -0,0 +1,127 @@
+package merk
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lithdew/bytesutil"
+)
+
+// A snapshot is a pin of a committed root with a reference count. Nodes are content-addressed
+// and shared with the live tree, so taking a snapshot costs O(1), and its nodes are kept from
+// garbage collection until the last reference is released.
+
+type Snapshot struct {
+	Root Hash
+	Refs uint64
+}
+
+func snapshotKey(root Hash) []byte {
+	return append(append([]byte{}, SnapshotKeyPrefix...), root[:]...)
+}
+
+// snapshotRefs returns the reference count of the root, 0 if not pinned
+func snapshotRefs(db DB, root Hash) (uint64, error) {
+	value, err := db.Get(snapshotKey(root))
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return decodeRefs(value), nil
+}
+
+// decodeRefs treats an empty value as a single reference, which is written by the older versions
+func decodeRefs(value []byte) uint64 {
+	if len(value) < 8 {
+		return 1
+	}
+	return bytesutil.Uint64BE(value)
+}
+
+// TakeDBSnapshot pins the stored tree, returns the root hash as the snapshot key
+func (m *Merk) TakeDBSnapshot() (Hash, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.db == nil {
+		return NullHash, ErrDBClosed
+	}
+
+	if m.opts.ReadOnly {
+		return NullHash, ErrReadOnly
+	}
+
+	root, err := storedRoot(m.db)
+	if err != nil {
+		return NullHash, err
+	}
+
+	if root == NullHash {
+		return NullHash, fmt.Errorf("%w: no tree is stored", ErrEmptyTree)
+	}
+
+	refs, err := snapshotRefs(m.db, root)
+	if err != nil {
+		return NullHash, err
+	}
+
+	if err := m.db.Put(snapshotKey(root), bytesutil.AppendUint64BE(nil, refs+1)); err != nil {
+		return NullHash, err
+	}
+
+	return root, nil
+}
+
+// Snapshots returns the pinned roots with the reference counts
+func (m *Merk) Snapshots() ([]*Snapshot, error) {
+	if m.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	var snapshots []*Snapshot
+
+	err := m.db.Iterate(SnapshotKeyPrefix, func(key, value []byte) error {
+		s := &Snapshot{Refs: decodeRefs(value)}
+		copy(s.Root[:], key[len(SnapshotKeyPrefix):])
+		snapshots = append(snapshots, s)
+		return nil
+	})
+
+	return snapshots, err
+}
+
+// ReleaseSnapshot drops a reference of the snapshot, and deletes the nodes
+// no longer pinned when the last reference is released
+func (m *Merk) ReleaseSnapshot(root Hash) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.db == nil {
+		return ErrDBClosed
+	}
+
+	if m.opts.ReadOnly {
+		return ErrReadOnly
+	}
+
+	refs, err := snapshotRefs(m.db, root)
+	if err != nil {
+		return err
+	}
+
+	if refs == 0 {
+		return fmt.Errorf("%w: %v", ErrSnapshotNotFound, root)
+	}
+
+	if refs > 1 {
+		return m.db.Put(snapshotKey(root), bytesutil.AppendUint64BE(nil, refs-1))
+	}
+
+	if err := m.db.Delete(snapshotKey(root)); err != nil {
+		return err
+	}
+
+	return collectGarbage(m.db, m.gcRoots())
+}
@@ -0,0 +1,107 @@
+package merk
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSnapshotRefs(t *testing.T) {
+	db := NewMemDB()
+
+	m, err := New(db, DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.TakeDBSnapshot()
+	require.Error(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value"), true)
+	require.NoError(t, err)
+
+	// taking a snapshot writes no nodes
+	nodes := storedNodes(t, db)
+	root, err := m.TakeDBSnapshot()
+	require.NoError(t, err)
+	require.EqualValues(t, m.RootHash(), root)
+	require.EqualValues(t, nodes, storedNodes(t, db))
+
+	root2, err := m.TakeDBSnapshot()
+	require.NoError(t, err)
+	require.EqualValues(t, root, root2)
+
+	snapshots, err := m.Snapshots()
+	require.NoError(t, err)
+	require.EqualValues(t, []*Snapshot{&Snapshot{Root: root, Refs: 2}}, snapshots)
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value2"), true)
+	require.NoError(t, err)
+
+	// nodes are kept until the last reference is released
+	require.NoError(t, m.ReleaseSnapshot(root))
+	view, err := m.At(root)
+	require.NoError(t, err)
+	require.EqualValues(t, []byte("value"), mustGet(t, view, []byte("key1050")))
+
+	require.NoError(t, m.ReleaseSnapshot(root))
+	require.EqualValues(t, reachableNodes(t, db, m.RootHash()), storedNodes(t, db))
+
+	snapshots, err = m.Snapshots()
+	require.NoError(t, err)
+	require.Empty(t, snapshots)
+
+	require.Error(t, m.ReleaseSnapshot(root))
+}
+
+func TestReleaseRevertedSnapshot(t *testing.T) {
+	db := NewMemDB()
+
+	m, err := New(db, DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value"), true)
+	require.NoError(t, err)
+
+	root, err := m.TakeDBSnapshot()
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value2"), true)
+	require.NoError(t, err)
+
+	view, err := m.View()
+	require.NoError(t, err)
+
+	// the uncommitted tree keeps the snapshot nodes after the snapshot and the view are released
+	require.NoError(t, m.Revert(root))
+	require.NoError(t, m.ReleaseSnapshot(root))
+	require.NoError(t, view.Close())
+	require.NoError(t, m.Commit())
+
+	report, err := CheckRoot(db, m.RootHash())
+	require.NoError(t, err)
+	require.True(t, report.OK(), report.String())
+	require.EqualValues(t, root, m.RootHash())
+	require.EqualValues(t, reachableNodes(t, db, root), storedNodes(t, db))
+	require.EqualValues(t, []byte("value"), mustGet(t, m, []byte("key1050")))
+}
+
+func TestLegacySnapshot(t *testing.T) {
+	db := NewMemDB()
+
+	m, err := New(db, DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 10, Put, "value"), true)
+	require.NoError(t, err)
+
+	// pinned with an empty value by the older versions
+	root := m.RootHash()
+	require.NoError(t, db.Put(snapshotKey(root), []byte{}))
+
+	snapshots, err := m.Snapshots()
+	require.NoError(t, err)
+	require.EqualValues(t, []*Snapshot{&Snapshot{Root: root, Refs: 1}}, snapshots)
+
+	require.NoError(t, m.ReleaseSnapshot(root))
+	snapshots, err = m.Snapshots()
+	require.NoError(t, err)
+	require.Empty(t, snapshots)
+}
@@ -7,10 +7,15 @@ import (
 	"unsafe"
 )
 
+// nodeFormatVersion is the first byte of encoded nodes, see marshal
+const nodeFormatVersion uint8 = 1
+
 type Tree struct {
-	kv    *KV
-	left  Link
-	right Link
+	kv     *KV
+	left   Link
+	right  Link
+	db     DB   // storage which pruned children are fetched from
+	stored Hash // hash of the node when last stored, NullHash if never stored
 }
 
 func newTree(key, value []byte) *Tree {
@@ -38,22 +43,23 @@ func (t *Tree) Link(isLeft bool) Link {
 	return t.right
 }
 
-func (t *Tree) Child(isLeft bool) *Tree {
+// Child returns the child, which is fetched from db if pruned
+func (t *Tree) Child(isLeft bool) (*Tree, error) {
 	var l Link = t.Link(isLeft)
 	if l == nil {
-		return nil
+		return nil, nil
 	}
 
 	if l.linkType() == PrunedLink {
 		var h Hash = l.Hash()
-		child, err := gDB.fetchTree(h[:])
+		child, err := fetchTree(t.db, h[:])
 		if err != nil {
-			panic(fmt.Sprintf("BUG: failed to fetch node: %v", err))
+			return nil, fmt.Errorf("failed to fetch %v child of %v: %w", sideToStr(isLeft), t.Key(), err)
 		}
-		return child
+		return child, nil
 	}
 
-	return l.tree()
+	return l.tree(), nil
 }
 
 func (t *Tree) ChildHash(isLeft bool) Hash {
@@ -118,38 +124,57 @@ func (t *Tree) attach(isLeft bool, maybeChild *Tree) {
 	return
 }
 
-func (t *Tree) detach(isLeft bool) *Tree {
-	var slot Link = t.Link(isLeft)
-	if slot == nil {
+// clone returns a shallow copy of the node, so that applying a batch leaves the original tree unchanged
+func (t *Tree) clone() *Tree {
+	if t == nil {
 		return nil
 	}
 
-	t.setLink(isLeft, nil)
+	c := *t
+	return &c
+}
+
+// detach removes the child from the node, and returns the copy of it
+func (t *Tree) detach(isLeft bool) (*Tree, error) {
+	var slot Link = t.Link(isLeft)
+	if slot == nil {
+		return nil, nil
+	}
 
 	if slot.linkType() == PrunedLink {
-		var h Hash = slot.Hash()
-		child, err := gDB.fetchTree(h[:])
+		child, err := t.Child(isLeft)
 		if err != nil {
-			panic(fmt.Sprintf("failed to fetch node: %v", err))
+			return nil, err
 		}
-		return child
+		t.setLink(isLeft, nil)
+		return child, nil
 	}
 
-	return slot.tree()
+	t.setLink(isLeft, nil)
+
+	return slot.tree().clone(), nil
 }
 
-func (t *Tree) detachExpect(isLeft bool) (maybeChild *Tree) {
-	maybeChild = t.detach(isLeft)
+func (t *Tree) detachExpect(isLeft bool) (*Tree, error) {
+	maybeChild, err := t.detach(isLeft)
+	if err != nil {
+		return nil, err
+	}
 
 	if maybeChild == nil {
-		panic(fmt.Sprintf("Expected tree to have %v child, but got Nil", sideToStr(isLeft)))
+		return nil, fmt.Errorf("expected tree to have %v child, but got Nil", sideToStr(isLeft))
 	}
 
-	return
+	return maybeChild, nil
 }
 
 func (t *Tree) walk(isLeft bool, f func(tree *Tree) (*Tree, error)) error {
-	appliedTree, err := f(t.detach(isLeft))
+	maybeChild, err := t.detach(isLeft)
+	if err != nil {
+		return err
+	}
+
+	appliedTree, err := f(maybeChild)
 	if err != nil {
 		return err
 	}
@@ -159,20 +184,38 @@ func (t *Tree) walk(isLeft bool, f func(tree *Tree) (*Tree, error)) error {
 	return nil
 }
 
-func (t *Tree) walkExpect(isLeft bool, f func(tree *Tree) *Tree) {
-	var child *Tree = t.detachExpect(isLeft)
-	t.attach(isLeft, f(child))
+func (t *Tree) walkExpect(isLeft bool, f func(tree *Tree) (*Tree, error)) error {
+	child, err := t.detachExpect(isLeft)
+	if err != nil {
+		return err
+	}
+
+	appliedTree, err := f(child)
+	if err != nil {
+		return err
+	}
+
+	t.attach(isLeft, appliedTree)
+
+	return nil
 }
 
 func (t *Tree) withValue(value []byte) {
-	t.kv.value = value
-	t.kv.hash = KvHash(t.kv.key, value)
+	// kv may be shared with the original tree, see clone
+	t.kv = newKV(t.kv.key, value)
 }
 
 func (t *Tree) commit(c *Commiter) error {
-	commitHandler(t, c, ModifiedLink)
+	t.db = c.db
+
+	if err := commitHandler(t, c, ModifiedLink); err != nil {
+		return err
+	}
 
 	if doPrune := c.prune(t); doPrune {
+		left, right := t.left, t.right
+		c.onRevert(func() { t.left, t.right = left, right })
+
 		if t.Link(true) != nil {
 			t.left = t.left.intoPruned()
 		}
@@ -184,23 +227,16 @@ func (t *Tree) commit(c *Commiter) error {
 	return nil
 }
 
-func (t *Tree) commitsSnapshot(c *Commiter) error {
-	return commitHandler(t, c, StoredLink)
-}
-
 func (t *Tree) verify() error {
 	handler := func(l Link, compare func(l Link) bool) error {
-		if l != nil {
-			if compare(l) {
-				return fmt.Errorf("unbalanced tree :%v", t.Key())
-			}
-			if l.linkType() != PrunedLink {
-				if err := l.tree().verify(); err != nil {
-					return err
-				}
-			}
+		// pruned node is not in memory
+		if l == nil || l.linkType() == PrunedLink {
+			return nil
 		}
-		return nil
+		if compare(l) {
+			return fmt.Errorf("unbalanced tree :%v", t.Key())
+		}
+		return l.tree().verify()
 	}
 
 	err := handler(t.Link(true), func(l Link) bool { return string(t.Key()) <= string(l.key()) })
@@ -211,30 +247,19 @@ func (t *Tree) verify() error {
 	return handler(t.Link(false), func(l Link) bool { return string(t.Key()) >= string(l.key()) })
 }
 
+// marshal encodes the node as
+// version(1) | key length(4) | key | left link | right link | value,
+// where a link is flag(1) | hash(32) | child heights(2) and flag 0 means no link
 func (t *Tree) marshal(dst []byte) []byte {
-	var hash Hash
+	dst = append(dst, nodeFormatVersion)
 
 	// write key
 	dst = bytesutil.AppendUint32BE(dst, uint32(len(t.Key())))
 	dst = append(dst, t.Key()...)
 
-	// write left link
-	if t.Link(true) != nil {
-		dst = append(dst, uint8(1))
-		hash = t.Link(true).Hash()
-		dst = append(dst, hash[:]...)
-	} else {
-		dst = append(dst, uint8(0))
-	}
-
-	// write right link
-	if t.Link(false) != nil {
-		dst = append(dst, uint8(1))
-		hash = t.Link(false).Hash()
-		dst = append(dst, hash[:]...)
-	} else {
-		dst = append(dst, uint8(0))
-	}
+	// write links
+	dst = marshalLink(dst, t.Link(true))
+	dst = marshalLink(dst, t.Link(false))
 
 	// write value
 	dst = append(dst, t.Value()...)
@@ -242,31 +267,54 @@ func (t *Tree) marshal(dst []byte) []byte {
 	return dst
 }
 
-func unmarshalTree(buf []byte) *Tree {
+func marshalLink(dst []byte, l Link) []byte {
+	if l == nil {
+		return append(dst, uint8(0))
+	}
+
+	var hash Hash = l.Hash()
+	var ch [2]uint8 = l.ChildHeights()
+
+	dst = append(dst, uint8(1))
+	dst = append(dst, hash[:]...)
+	return append(dst, ch[:]...)
+}
+
+func unmarshalTree(buf []byte) (*Tree, error) {
 	var (
-		kLen              uint32
-		hasLeft, hasRight uint8
-		hash              Hash
+		kLen uint32
+		err  error
 	)
 
+	if len(buf) < 5 {
+		return nil, fmt.Errorf("%w: too short", ErrCorruptNode)
+	}
+
+	// legacy nodes start with the key length instead of version,
+	// whose first byte is 0 as long as the key is shorter than 16MiB
+	legacy := buf[0] != nodeFormatVersion
+	if !legacy {
+		buf = buf[1:]
+	}
+
 	t := &Tree{kv: &KV{}}
 
 	// read key
+	if len(buf) < 4 {
+		return nil, fmt.Errorf("%w: too short", ErrCorruptNode)
+	}
 	kLen, buf = bytesutil.Uint32BE(buf[:4]), buf[4:]
+	if uint32(len(buf)) < kLen {
+		return nil, fmt.Errorf("%w: key length %v exceeds the node", ErrCorruptNode, kLen)
+	}
 	t.kv.key, buf = buf[:kLen], buf[kLen:]
 
-	// read left
-	hasLeft, buf = uint8(buf[0]), buf[1:]
-	if hasLeft == 1 {
-		hash, buf = *(*Hash)(unsafe.Pointer(&((buf[:HashSize])[0]))), buf[HashSize:]
-		t.left = &Pruned{h: hash}
+	// read links
+	if t.left, buf, err = unmarshalLink(buf, legacy); err != nil {
+		return nil, err
 	}
-
-	// read right
-	hasRight, buf = uint8(buf[0]), buf[1:]
-	if hasRight == 1 {
-		hash, buf = *(*Hash)(unsafe.Pointer(&((buf[:HashSize])[0]))), buf[HashSize:]
-		t.right = &Pruned{h: hash}
+	if t.right, buf, err = unmarshalLink(buf, legacy); err != nil {
+		return nil, err
 	}
 
 	// read value
@@ -275,44 +323,73 @@ func unmarshalTree(buf []byte) *Tree {
 	// calculate hash
 	t.kv.hash = KvHash(t.kv.key, t.kv.value)
 
-	return t
+	return t, nil
 }
 
-func commitHandler(t *Tree, c *Commiter, lType LinkType) error {
-	// Note: if use concurency, slow down when low spec pc
-	chErr := make(chan error, 2)
-
-	handler := func(l Link, isLeft bool) {
-		if l != nil && l.linkType() == lType {
-			go func() {
-
-				if err := l.tree().commit(c); err != nil {
-					chErr <- err
-					return
-				}
-
-				t.setLink(isLeft, &Stored{
-					ch: l.ChildHeights(),
-					t:  l.tree(),
-					h:  l.tree().Hash(),
-				})
-
-				chErr <- nil
-			}()
-		} else {
-			chErr <- nil
-		}
+func unmarshalLink(buf []byte, legacy bool) (Link, []byte, error) {
+	var (
+		hasLink uint8
+		hash    Hash
+		ch      [2]uint8
+	)
+
+	size := 1 + HashSize + 2
+	if legacy {
+		size = 1 + HashSize
 	}
 
-	handler(t.Link(true), true)
-	handler(t.Link(false), false)
+	if len(buf) < 1 {
+		return nil, nil, fmt.Errorf("%w: missing link", ErrCorruptNode)
+	}
+
+	hasLink, buf = uint8(buf[0]), buf[1:]
+	if hasLink != 1 {
+		return nil, buf, nil
+	}
+
+	if len(buf) < size-1 {
+		return nil, nil, fmt.Errorf("%w: truncated link", ErrCorruptNode)
+	}
+
+	hash, buf = *(*Hash)(unsafe.Pointer(&((buf[:HashSize])[0]))), buf[HashSize:]
 
-	for i := 0; i < cap(chErr); i++ {
-		if err := <-chErr; err != nil {
-			return err
+	// legacy nodes don't have child heights, see Migrate
+	if !legacy {
+		ch, buf = [2]uint8{buf[0], buf[1]}, buf[2:]
+	}
+
+	return &Pruned{ch: ch, h: hash}, buf, nil
+}
+
+func commitHandler(t *Tree, c *Commiter, lType LinkType) error {
+	handler := func(isLeft bool) func() error {
+		l := t.Link(isLeft)
+
+		return func() error {
+			if l == nil || l.linkType() != lType {
+				return nil
+			}
+
+			if err := l.tree().commit(c); err != nil {
+				return err
+			}
+
+			t.setLink(isLeft, &Stored{
+				ch: l.ChildHeights(),
+				t:  l.tree(),
+				h:  l.tree().Hash(),
+			})
+			c.onRevert(func() { t.setLink(isLeft, l) })
+
+			return nil
 		}
 	}
 
+	err := c.workers.fork(c.workers.heightParallel(t.height()), handler(true), handler(false))
+	if err != nil {
+		return err
+	}
+
 	if err := c.write(t); err != nil {
 		return err
 	}
@@ -1,6 +1,7 @@
 package merk
 
 import (
+	"errors"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/blake2b"
 	"testing"
@@ -31,15 +32,38 @@ func TestMarshal(t *testing.T) {
 	var buf []byte
 	buf = tree.marshal(buf)
 
-	require.EqualValues(t, []byte{0x0, 0x0, 0x0, 0x3, 0x6b, 0x65, 0x79, 0x1, 0xe, 0x57, 0x51, 0xc0, 0x26, 0xe5, 0x43, 0xb2, 0xe8, 0xab, 0x2e, 0xb0, 0x60, 0x99, 0xda, 0xa1, 0xd1, 0xe5, 0xdf, 0x47, 0x77, 0x8f, 0x77, 0x87, 0xfa, 0xab, 0x45, 0xcd, 0xf1, 0x2f, 0xe3, 0xa8, 0x1, 0xe, 0x57, 0x51, 0xc0, 0x26, 0xe5, 0x43, 0xb2, 0xe8, 0xab, 0x2e, 0xb0, 0x60, 0x99, 0xda, 0xa1, 0xd1, 0xe5, 0xdf, 0x47, 0x77, 0x8f, 0x77, 0x87, 0xfa, 0xab, 0x45, 0xcd, 0xf1, 0x2f, 0xe3, 0xa8, 0x76, 0x61, 0x6c, 0x75, 0x65}, buf)
+	require.EqualValues(t, []byte{0x1, 0x0, 0x0, 0x0, 0x3, 0x6b, 0x65, 0x79, 0x1, 0xe, 0x57, 0x51, 0xc0, 0x26, 0xe5, 0x43, 0xb2, 0xe8, 0xab, 0x2e, 0xb0, 0x60, 0x99, 0xda, 0xa1, 0xd1, 0xe5, 0xdf, 0x47, 0x77, 0x8f, 0x77, 0x87, 0xfa, 0xab, 0x45, 0xcd, 0xf1, 0x2f, 0xe3, 0xa8, 0x1, 0x2, 0x1, 0xe, 0x57, 0x51, 0xc0, 0x26, 0xe5, 0x43, 0xb2, 0xe8, 0xab, 0x2e, 0xb0, 0x60, 0x99, 0xda, 0xa1, 0xd1, 0xe5, 0xdf, 0x47, 0x77, 0x8f, 0x77, 0x87, 0xfa, 0xab, 0x45, 0xcd, 0xf1, 0x2f, 0xe3, 0xa8, 0x2, 0x0, 0x76, 0x61, 0x6c, 0x75, 0x65}, buf)
 }
 
 func TestUnMarshalTree(t *testing.T) {
+	var data []byte = []byte{0x1, 0x0, 0x0, 0x0, 0x3, 0x6b, 0x65, 0x79, 0x1, 0xe, 0x57, 0x51, 0xc0, 0x26, 0xe5, 0x43, 0xb2, 0xe8, 0xab, 0x2e, 0xb0, 0x60, 0x99, 0xda, 0xa1, 0xd1, 0xe5, 0xdf, 0x47, 0x77, 0x8f, 0x77, 0x87, 0xfa, 0xab, 0x45, 0xcd, 0xf1, 0x2f, 0xe3, 0xa8, 0x1, 0x2, 0x1, 0xe, 0x57, 0x51, 0xc0, 0x26, 0xe5, 0x43, 0xb2, 0xe8, 0xab, 0x2e, 0xb0, 0x60, 0x99, 0xda, 0xa1, 0xd1, 0xe5, 0xdf, 0x47, 0x77, 0x8f, 0x77, 0x87, 0xfa, 0xab, 0x45, 0xcd, 0xf1, 0x2f, 0xe3, 0xa8, 0x2, 0x0, 0x76, 0x61, 0x6c, 0x75, 0x65}
+
+	hash := blake2b.Sum256([]byte(""))
+
+	tree, err := unmarshalTree(data)
+	require.NoError(t, err)
+
+	require.EqualValues(t, tree.Key(), []byte("key"))
+	require.EqualValues(t, tree.Value(), []byte("value"))
+	require.EqualValues(t, tree.Link(true).Hash(), hash)
+	require.EqualValues(t, tree.Link(false).Hash(), hash)
+	require.EqualValues(t, tree.Link(true).ChildHeights(), [2]uint8{1, 2})
+	require.EqualValues(t, tree.Link(false).ChildHeights(), [2]uint8{2, 0})
+	require.EqualValues(t, tree.ChildHeights(), [2]uint8{3, 3})
+
+	for _, n := range []int{0, 4, 7, 10, 50} {
+		_, err = unmarshalTree(data[:n])
+		require.True(t, errors.Is(err, ErrCorruptNode))
+	}
+}
+
+func TestUnMarshalLegacyTree(t *testing.T) {
 	var data []byte = []byte{0x0, 0x0, 0x0, 0x3, 0x6b, 0x65, 0x79, 0x1, 0xe, 0x57, 0x51, 0xc0, 0x26, 0xe5, 0x43, 0xb2, 0xe8, 0xab, 0x2e, 0xb0, 0x60, 0x99, 0xda, 0xa1, 0xd1, 0xe5, 0xdf, 0x47, 0x77, 0x8f, 0x77, 0x87, 0xfa, 0xab, 0x45, 0xcd, 0xf1, 0x2f, 0xe3, 0xa8, 0x1, 0xe, 0x57, 0x51, 0xc0, 0x26, 0xe5, 0x43, 0xb2, 0xe8, 0xab, 0x2e, 0xb0, 0x60, 0x99, 0xda, 0xa1, 0xd1, 0xe5, 0xdf, 0x47, 0x77, 0x8f, 0x77, 0x87, 0xfa, 0xab, 0x45, 0xcd, 0xf1, 0x2f, 0xe3, 0xa8, 0x76, 0x61, 0x6c, 0x75, 0x65}
 
 	hash := blake2b.Sum256([]byte(""))
 
-	tree := unmarshalTree(data)
+	tree, err := unmarshalTree(data)
+	require.NoError(t, err)
 
 	require.EqualValues(t, tree.Key(), []byte("key"))
 	require.EqualValues(t, tree.Value(), []byte("value"))
@@ -50,7 +74,7 @@ func TestUnMarshalTree(t *testing.T) {
 func TestTreeCommit(t *testing.T) {
 	tree := buildTree()
 
-	committer := newCommitter(nil, tree.height(), 1)
+	committer := newCommitter(nil, nil, tree.height(), 1, nil)
 
 	tree.commit(committer)
 
@@ -104,3 +128,12 @@ func buildTree() *Tree {
 
 	return tree
 }
+
+// mustChild returns the child, panics if it fails to fetch
+func (t *Tree) mustChild(isLeft bool) *Tree {
+	child, err := t.Child(isLeft)
+	if err != nil {
+		panic(err)
+	}
+	return child
+}
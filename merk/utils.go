@@ -56,3 +56,14 @@ func RandIntn(max int) int {
 	rand.Seed(time.Now().UnixNano())
 	return rand.Intn(max)
 }
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	c := make([]byte, len(b))
+	copy(c, b)
+
+	return c
+}
@@ -0,0 +1,130 @@
+package merk
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lithdew/bytesutil"
+)
+
+// Every commit records the root hash as a new version under VersionKeyPrefix.
+// The roots of retained versions are pinned, so their nodes are kept from garbage collection.
+
+func versionKey(version uint64) []byte {
+	return bytesutil.AppendUint64BE(append([]byte{}, VersionKeyPrefix...), version)
+}
+
+// loadVersions returns the stored versions in ascending order
+func loadVersions(db DB) ([]uint64, error) {
+	var versions []uint64
+
+	err := db.Iterate(VersionKeyPrefix, func(key, value []byte) error {
+		versions = append(versions, bytesutil.Uint64BE(key[len(VersionKeyPrefix):]))
+		return nil
+	})
+
+	return versions, err
+}
+
+// Version returns the version of the tree, 0 if never committed
+func (m *Merk) Version() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.version
+}
+
+// Versions returns the retained versions in ascending order
+func (m *Merk) Versions() []uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	versions := make([]uint64, len(m.versions))
+	copy(versions, m.versions)
+	return versions
+}
+
+// LoadVersion replaces the tree with the one committed at the version.
+// The next commit creates version+1 and discards the versions after it.
+func (m *Merk) LoadVersion(version uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.db == nil {
+		return ErrDBClosed
+	}
+
+	value, err := m.db.Get(versionKey(version))
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: %v", ErrVersionNotFound, version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get version %v: %w", version, err)
+	}
+
+	var (
+		target Hash
+		tree   *Tree
+	)
+
+	copy(target[:], value)
+
+	if target != NullHash {
+		tree, err = fetchTrees(m.db, target[:], m.opts.Levels)
+		if err != nil {
+			return err
+		}
+	}
+
+	root, err := storedRoot(m.db)
+	if err != nil {
+		return err
+	}
+
+	orphans, revived, err := diffRoots(m.db, root, target)
+	if err != nil {
+		return err
+	}
+
+	m.Tree, m.orphans, m.revived, m.pending, m.version = tree, orphans, revived, nil, version
+
+	return nil
+}
+
+// writeVersion records the root as the version, and deletes the versions
+// overwritten by it or out of the retention. Returns the retained versions
+// and true if any version is deleted.
+func (m *Merk) writeVersion(wb WriteBatch, version uint64, root Hash) ([]uint64, bool, error) {
+	var (
+		retained []uint64
+		released bool
+	)
+
+	if err := wb.Put(versionKey(version), root[:]); err != nil {
+		return nil, false, err
+	}
+
+	for _, v := range m.versions {
+		if v >= version {
+			// discarded by LoadVersion, or overwritten
+			if v > version {
+				if err := wb.Delete(versionKey(v)); err != nil {
+					return nil, false, err
+				}
+			}
+			released = true
+			continue
+		}
+
+		if !m.opts.retains(v, version) {
+			if err := wb.Delete(versionKey(v)); err != nil {
+				return nil, false, err
+			}
+			released = true
+			continue
+		}
+
+		retained = append(retained, v)
+	}
+
+	return append(retained, version), released, nil
+}
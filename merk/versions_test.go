@@ -0,0 +1,107 @@
+package merk
+
+import (
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+)
+
+func TestLoadVersion(t *testing.T) {
+	db := NewMemDB()
+
+	opts := DefaultOptions()
+	opts.KeepRecent = 0
+
+	m, err := New(db, opts)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, m.Version())
+
+	roots := make(map[uint64]Hash)
+	for i := 1; i <= 5; i++ {
+		_, err = m.Apply(buildSeqBatch(0, 20*i, Put, "value"+strconv.Itoa(i)), true)
+		require.NoError(t, err)
+		require.EqualValues(t, i, m.Version())
+		roots[m.Version()] = m.RootHash()
+	}
+	require.Equal(t, []uint64{1, 2, 3, 4, 5}, m.Versions())
+
+	require.NoError(t, m.LoadVersion(3))
+	require.EqualValues(t, 3, m.Version())
+	require.EqualValues(t, roots[3], m.RootHash())
+	require.EqualValues(t, []byte("value3"), mustGet(t, m, []byte("key1000")))
+	require.False(t, mustHas(t, m, []byte("key1060")))
+
+	// reopen before commit loads the latest version
+	m2, err := New(db, opts)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, m2.Version())
+	require.EqualValues(t, roots[5], m2.RootHash())
+
+	_, err = m.Apply(buildSeqBatch(0, 10, Put, "value6"), true)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, m.Version())
+	require.Equal(t, []uint64{1, 2, 3, 4}, m.Versions())
+
+	m2, err = New(db, opts)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, m2.Version())
+	require.Equal(t, []uint64{1, 2, 3, 4}, m2.Versions())
+	require.EqualValues(t, m.RootHash(), m2.RootHash())
+
+	// nodes of the discarded version are collected
+	live := make(map[Hash]bool)
+	for _, root := range []Hash{roots[1], roots[2], roots[3], m.RootHash()} {
+		for h := range reachableNodes(t, db, root) {
+			live[h] = true
+		}
+	}
+	require.EqualValues(t, live, storedNodes(t, db))
+
+	require.Error(t, m.LoadVersion(5))
+}
+
+func TestVersionRetention(t *testing.T) {
+	db := NewMemDB()
+
+	opts := DefaultOptions()
+	opts.KeepRecent = 2
+	opts.KeepEvery = 3
+
+	m, err := New(db, opts)
+	require.NoError(t, err)
+
+	roots := make(map[uint64]Hash)
+	for i := 1; i <= 10; i++ {
+		_, err = m.Apply(buildSeqBatch(5*i, 5*i+20, Put, "value"+strconv.Itoa(i)), true)
+		require.NoError(t, err)
+		roots[m.Version()] = m.RootHash()
+	}
+	require.Equal(t, []uint64{3, 6, 9, 10}, m.Versions())
+
+	live := make(map[Hash]bool)
+	for _, v := range m.Versions() {
+		for h := range reachableNodes(t, db, roots[v]) {
+			live[h] = true
+		}
+	}
+	require.EqualValues(t, live, storedNodes(t, db))
+
+	require.NoError(t, m.LoadVersion(6))
+	require.EqualValues(t, roots[6], m.RootHash())
+	require.EqualValues(t, []byte("value6"), mustGet(t, m, []byte("key1049")))
+	require.Error(t, m.LoadVersion(7))
+}
+
+func TestRetainsVersion(t *testing.T) {
+	opts := DefaultOptions()
+	require.True(t, opts.retains(10, 10))
+	require.False(t, opts.retains(9, 10))
+
+	opts.KeepRecent = 0
+	require.True(t, opts.retains(1, 10))
+
+	opts.KeepRecent, opts.KeepEvery = 3, 4
+	require.True(t, opts.retains(8, 10))
+	require.False(t, opts.retains(7, 10))
+	require.True(t, opts.retains(4, 10))
+}
@@ -0,0 +1,187 @@
+package merk
+
+import (
+	"errors"
+	"fmt"
+)
+
+// View is a read-only handle of a committed tree, unaffected by the later writes to the Merk.
+// Nodes are fetched from db on demand, so the root must be retained (live, a version or
+// a snapshot) while the view is used, unless the view is pinned by Merk.View.
+// It's safe for concurrent use.
+type View struct {
+	Tree *Tree
+
+	release func() error
+}
+
+// View returns the view of the last committed tree, which reads a consistent state while
+// the Merk is written and committed. The nodes are kept from garbage collection until Close.
+func (m *Merk) View() (*View, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	if m.committed == nil {
+		return &View{}, nil // empty tree
+	}
+
+	root := m.committed.Hash()
+
+	m.pinMu.Lock()
+	defer m.pinMu.Unlock()
+
+	if m.pins == nil {
+		m.pins = make(map[Hash]int)
+	}
+	m.pins[root]++
+
+	return &View{Tree: m.committed, release: func() error { return m.unpin(root) }}, nil
+}
+
+// At returns the view of the tree committed with the root hash
+func (m *Merk) At(root Hash) (*View, error) {
+	if m.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	if root == NullHash {
+		return &View{}, nil // empty tree
+	}
+
+	tree, err := fetchTree(m.db, root[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch root %v: %w", root, err)
+	}
+
+	return &View{Tree: tree}, nil
+}
+
+// AtVersion returns the view of the tree committed at the version
+func (m *Merk) AtVersion(version uint64) (*View, error) {
+	if m.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	value, err := m.db.Get(versionKey(version))
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %v", ErrVersionNotFound, version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version %v: %w", version, err)
+	}
+
+	var root Hash
+	copy(root[:], value)
+
+	return m.At(root)
+}
+
+// Get returns nil if the key is not found, use GetWithFound to tell it from an empty value
+func (v *View) Get(key []byte) ([]byte, error) {
+	value, _, err := v.GetWithFound(key)
+	return value, err
+}
+
+func (v *View) GetWithFound(key []byte) ([]byte, bool, error) {
+	return getWithFound(v.Tree, key)
+}
+
+func (v *View) Has(key []byte) (bool, error) {
+	_, found, err := v.GetWithFound(key)
+	return found, err
+}
+
+// Close releases the nodes pinned by the view, which must not be used after that
+func (v *View) Close() error {
+	if v.release == nil {
+		return nil
+	}
+
+	release := v.release
+	v.release = nil
+
+	return release()
+}
+
+func (v *View) RootHash() Hash {
+	if v.Tree == nil {
+		return NullHash
+	}
+	return v.Tree.Hash()
+}
+
+// Iterator returns an ascending iterator over [start, end), nil means unbounded
+func (v *View) Iterator(start, end []byte) *Iterator {
+	return newIterator(v.Tree, start, end, false)
+}
+
+// ReverseIterator returns a descending iterator over [start, end), nil means unbounded
+func (v *View) ReverseIterator(start, end []byte) *Iterator {
+	return newIterator(v.Tree, start, end, true)
+}
+
+// unpin releases the root pinned by View. The garbage is collected only if the last pin of
+// the root is released, and orphans were recorded as pending while it was pinned.
+func (m *Merk) unpin(root Hash) error {
+	m.pinMu.Lock()
+	collect := false
+	if m.pins[root]--; m.pins[root] == 0 {
+		delete(m.pins, root)
+		collect = m.gc[root]
+		delete(m.gc, root)
+	}
+	m.pinMu.Unlock()
+
+	if !collect {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.db == nil || m.opts.ReadOnly {
+		return nil
+	}
+
+	return collectGarbage(m.db, m.gcRoots())
+}
+
+// pinOrphans records that the roots pinned by the views kept orphans pending
+func (m *Merk) pinOrphans() {
+	m.pinMu.Lock()
+	defer m.pinMu.Unlock()
+
+	if len(m.pins) == 0 {
+		return
+	}
+
+	if m.gc == nil {
+		m.gc = make(map[Hash]bool)
+	}
+	for h := range m.pins {
+		m.gc[h] = true
+	}
+}
+
+// gcRoots returns the roots kept by collectGarbage besides the stored ones, which are the views
+// and the pending orphans revived by the uncommitted Revert or LoadVersion
+func (m *Merk) gcRoots() []Hash {
+	return append(m.pinnedViews(), m.revived...)
+}
+
+// pinnedViews returns the roots pinned by the open views
+func (m *Merk) pinnedViews() []Hash {
+	m.pinMu.Lock()
+	defer m.pinMu.Unlock()
+
+	roots := make([]Hash, 0, len(m.pins))
+	for h := range m.pins {
+		roots = append(roots, h)
+	}
+
+	return roots
+}
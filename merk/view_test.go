@@ -0,0 +1,180 @@
+package merk
+
+import (
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestView(t *testing.T) {
+	db := NewMemDB()
+
+	opts := DefaultOptions()
+	opts.KeepRecent = 0
+
+	m, err := New(db, opts)
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value1"), true)
+	require.NoError(t, err)
+
+	root := m.RootHash()
+	view, err := m.At(root)
+	require.NoError(t, err)
+	require.EqualValues(t, root, view.RootHash())
+
+	// the view keeps reading the old state while the live tree is written
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			key := []byte("key" + strconv.Itoa(1000+i))
+			value, found, err := view.GetWithFound(key)
+			require.NoError(t, err)
+			require.True(t, found)
+			require.EqualValues(t, []byte("value1"), value)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		_, err := m.Apply(buildSeqBatch(50, 150, Put, "value2"), true)
+		require.NoError(t, err)
+		_, err = m.Apply(buildSeqBatch(0, 30, Del, ""), true)
+		require.NoError(t, err)
+	}()
+	wg.Wait()
+
+	require.False(t, mustHas(t, view, []byte("key1120")))
+	require.True(t, mustHas(t, m, []byte("key1120")))
+	require.False(t, mustHas(t, m, []byte("key1000")))
+
+	it := view.ReverseIterator(nil, nil)
+	defer it.Close()
+	for i := 99; i >= 0; i-- {
+		require.True(t, it.Next())
+		require.EqualValues(t, []byte("key"+strconv.Itoa(1000+i)), it.Key())
+		require.EqualValues(t, []byte("value1"), it.Value())
+	}
+	require.False(t, it.Next())
+
+	view, err = m.AtVersion(2)
+	require.NoError(t, err)
+	require.EqualValues(t, []byte("value2"), mustGet(t, view, []byte("key1050")))
+	require.EqualValues(t, []byte("value1"), mustGet(t, view, []byte("key1000")))
+
+	view, err = m.At(NullHash)
+	require.NoError(t, err)
+	require.Nil(t, mustGet(t, view, []byte("key1000")))
+
+	_, err = m.At(Hash{1})
+	require.Error(t, err)
+	_, err = m.AtVersion(4)
+	require.Error(t, err)
+}
+
+func TestViewConcurrentWrite(t *testing.T) {
+	db := NewMemDB()
+
+	m, err := New(db, DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value0"), true)
+	require.NoError(t, err)
+
+	// the views read a consistent state while the writer rewrites all keys
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 20; i++ {
+			_, err := m.Apply(buildSeqBatch(0, 100, Put, "value"+strconv.Itoa(i)), true)
+			require.NoError(t, err)
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				view, err := m.View()
+				require.NoError(t, err)
+
+				value := mustGet(t, view, []byte("key1000"))
+
+				it := view.Iterator(nil, nil)
+				count := 0
+				for ; it.Next(); count++ {
+					require.EqualValues(t, value, it.Value())
+				}
+				require.NoError(t, it.Err())
+				require.EqualValues(t, 100, count)
+
+				require.NotNil(t, mustGet(t, m, []byte("key1050")))
+				require.NoError(t, view.Close())
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the pinned nodes are kept until the view is closed
+	view, err := m.View()
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 90, Del, ""), true)
+	require.NoError(t, err)
+
+	it := view.Iterator(nil, nil)
+	count := 0
+	for ; it.Next(); count++ {
+		require.EqualValues(t, []byte("value20"), it.Value())
+	}
+	require.NoError(t, it.Err())
+	require.EqualValues(t, 100, count)
+
+	require.NoError(t, view.Close())
+	require.NoError(t, view.Close())
+	require.EqualValues(t, reachableNodes(t, db, m.RootHash()), storedNodes(t, db))
+}
+
+func TestViewCloseCollect(t *testing.T) {
+	db := NewMemDB()
+
+	m, err := New(db, DefaultOptions())
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 100, Put, "value"), true)
+	require.NoError(t, err)
+
+	// nothing was kept pending, so close doesn't wait for the writer
+	view, err := m.View()
+	require.NoError(t, err)
+
+	m.mu.Lock()
+	require.NoError(t, view.Close())
+	m.mu.Unlock()
+
+	// the pending orphans are collected on the last close of the root
+	first, err := m.View()
+	require.NoError(t, err)
+	second, err := m.View()
+	require.NoError(t, err)
+
+	_, err = m.Apply(buildSeqBatch(0, 50, Del, ""), true)
+	require.NoError(t, err)
+
+	require.NoError(t, first.Close())
+
+	it := second.Iterator(nil, nil)
+	count := 0
+	for ; it.Next(); count++ {
+	}
+	require.NoError(t, it.Err())
+	require.EqualValues(t, 100, count)
+
+	require.NoError(t, second.Close())
+	require.EqualValues(t, reachableNodes(t, db, m.RootHash()), storedNodes(t, db))
+	require.Empty(t, m.gc)
+}
@@ -0,0 +1,86 @@
+package merk
+
+import (
+	"fmt"
+)
+
+// workers bounds the goroutines spawned by apply and commit, which split the work at every level
+// of the tree. Small batches and low subtrees are processed in the caller, as spawning costs more
+// than it saves. nil workers process everything sequentially.
+type workers struct {
+	sem       chan struct{}
+	minBatch  int
+	minHeight uint8
+}
+
+func newWorkers(opts Options) *workers {
+	if opts.MaxWorkers == 0 {
+		return nil
+	}
+
+	return &workers{
+		sem:       make(chan struct{}, opts.MaxWorkers),
+		minBatch:  opts.MinParallelBatch,
+		minHeight: opts.MinParallelHeight,
+	}
+}
+
+// batchParallel reports whether the batches of both children are large enough to apply in parallel
+func (w *workers) batchParallel(left, right int) bool {
+	return w != nil && left > 0 && right > 0 && left >= w.minBatch && right >= w.minBatch
+}
+
+// heightParallel reports whether the subtree is high enough to commit the children in parallel
+func (w *workers) heightParallel(height uint8) bool {
+	return w != nil && height >= w.minHeight
+}
+
+// fork runs left in a new goroutine if parallel and a worker is free, otherwise in the caller
+// like right. Returns the first error after both finished.
+func (w *workers) fork(parallel bool, left, right func() error) error {
+	if !parallel || !w.acquire() {
+		if err := safely(left); err != nil {
+			return err
+		}
+		return safely(right)
+	}
+
+	chErr := make(chan error, 1)
+	go func() {
+		defer w.release()
+		chErr <- safely(left)
+	}()
+
+	err := safely(right)
+
+	// wait for left even if right failed, as both touch the tree
+	if e := <-chErr; e != nil && err == nil {
+		err = e
+	}
+
+	return err
+}
+
+func (w *workers) acquire() bool {
+	select {
+	case w.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *workers) release() {
+	<-w.sem
+}
+
+// safely runs f, reporting the bug as error instead of crashing the process
+func safely(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while processing tree: %v", r)
+		}
+	}()
+
+	return f()
+}
@@ -0,0 +1,88 @@
+package merk
+
+import (
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkersBudget(t *testing.T) {
+	w := newWorkers(Options{MaxWorkers: 2})
+
+	var active, peak int32
+
+	var run func(depth int) error
+	run = func(depth int) error {
+		if depth == 0 {
+			n := atomic.AddInt32(&active, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&active, -1)
+			return nil
+		}
+
+		f := func() error { return run(depth - 1) }
+		return w.fork(true, f, f)
+	}
+
+	require.NoError(t, run(6))
+	require.True(t, peak > 1)
+	require.True(t, peak <= 3) // the caller and 2 workers
+	require.Zero(t, len(w.sem))
+
+	// panic is reported as error
+	err := w.fork(true, func() error { panic("bug") }, func() error { return nil })
+	require.Error(t, err)
+	require.Zero(t, len(w.sem))
+
+	var nilWorkers *workers
+	require.False(t, nilWorkers.batchParallel(1000, 1000))
+	require.Error(t, nilWorkers.fork(false, func() error { return nil }, func() error { panic("bug") }))
+}
+
+func TestWorkersRootHash(t *testing.T) {
+	sequential := DefaultOptions()
+	sequential.MaxWorkers = 0
+
+	eager := DefaultOptions()
+	eager.MaxWorkers = 4
+	eager.MinParallelBatch = 0
+	eager.MinParallelHeight = 0
+
+	var (
+		roots []Hash
+		nodes []map[Hash]bool
+	)
+
+	for _, opts := range []Options{sequential, eager, DefaultOptions()} {
+		m, err := New(NewMemDB(), opts)
+		require.NoError(t, err)
+
+		_, err = m.Apply(buildSeqBatch(0, 5000, Put, "value"), true)
+		require.NoError(t, err)
+		_, err = m.Apply(buildSeqBatch(1000, 3000, Del, ""), true)
+		require.NoError(t, err)
+		_, err = m.Apply(buildSeqBatch(2000, 8000, Put, "value2"), true)
+		require.NoError(t, err)
+		require.NoError(t, m.Tree.verify())
+
+		roots = append(roots, m.RootHash())
+		nodes = append(nodes, storedNodes(t, m.db))
+	}
+
+	require.EqualValues(t, roots[0], roots[1])
+	require.EqualValues(t, roots[0], roots[2])
+	require.EqualValues(t, nodes[0], nodes[1])
+	require.EqualValues(t, nodes[0], nodes[2])
+
+	opts := DefaultOptions()
+	opts.MaxWorkers = -1
+	_, err := New(NewMemDB(), opts)
+	require.Error(t, err)
+}